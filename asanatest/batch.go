@@ -0,0 +1,69 @@
+package asanatest
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "net/http/httptest"
+import "strings"
+
+type batchAction struct {
+	RelativePath string          `json:"relative_path"`
+	Method       string          `json:"method"`
+	Data         json.RawMessage `json:"data"`
+}
+
+type batchRequest struct {
+	Data *struct {
+		Actions []*batchAction `json:"actions"`
+	} `json:"data"`
+}
+
+type batchActionResult struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers"`
+	Body       json.RawMessage   `json:"body"`
+}
+
+const maxBatchActions = 10
+
+func (s *Server) batch(w http.ResponseWriter, r *http.Request, _ []string) {
+	req := &batchRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil || req.Data == nil {
+		writeError(w, http.StatusBadRequest, "data: Missing input")
+		return
+	}
+
+	if len(req.Data.Actions) > maxBatchActions {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("actions: Too many actions (max %d)", maxBatchActions))
+		return
+	}
+
+	results := []*batchActionResult{}
+
+	for _, action := range req.Data.Actions {
+		body := []byte{}
+		if len(action.Data) > 0 {
+			body, err = json.Marshal(map[string]json.RawMessage{"data": action.Data})
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		sub := httptest.NewRequest(strings.ToUpper(action.Method), action.RelativePath, bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		s.route(rec, sub)
+
+		results = append(results, &batchActionResult{
+			StatusCode: rec.Code,
+			Headers:    map[string]string{},
+			Body:       rec.Body.Bytes(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: results})
+}
@@ -0,0 +1,272 @@
+package asanatest
+
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "strconv"
+import "strings"
+
+import "github.com/firestuff/automana/client"
+
+type customField struct {
+	*client.CustomField
+	workspace *client.Workspace
+}
+
+type customFieldSetting struct {
+	GID         string              `json:"gid"`
+	CustomField *client.CustomField `json:"custom_field"`
+	Project     *client.Project     `json:"project"`
+	IsImportant bool                `json:"is_important"`
+}
+
+// AddCustomField defines a custom field in wrk, filling in GIDs for the
+// field and its enum options. Type defaults to ResourceSubtype.
+func (s *Server) AddCustomField(wrk *client.Workspace, cf *client.CustomField) *client.CustomField {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *cf
+	stored.EnumOptions = []*client.EnumOption{}
+
+	if stored.GID == "" {
+		stored.GID = s.gid()
+	}
+
+	if stored.Type == "" {
+		stored.Type = stored.ResourceSubtype
+	}
+
+	for _, opt := range cf.EnumOptions {
+		o := *opt
+		if o.GID == "" {
+			o.GID = s.gid()
+		}
+		stored.EnumOptions = append(stored.EnumOptions, &o)
+	}
+
+	s.customFields = append(s.customFields, &customField{
+		CustomField: &stored,
+		workspace:   wrk,
+	})
+
+	return &stored
+}
+
+func (s *Server) AddCustomFieldSetting(proj *client.Project, cf *client.CustomField) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.customFieldSettings = append(s.customFieldSettings, &customFieldSetting{
+		GID:         s.gid(),
+		CustomField: s.findCustomField(cf.GID).CustomField,
+		Project:     s.findProject(proj.GID).Project,
+	})
+}
+
+func (s *Server) getCustomFields(w http.ResponseWriter, r *http.Request, args []string) {
+	wrk := s.findWorkspace(args[0])
+	if wrk == nil {
+		writeError(w, http.StatusNotFound, "workspace: Unknown object")
+		return
+	}
+
+	cfs := []*client.CustomField{}
+	for _, cf := range s.customFields {
+		if cf.workspace == wrk {
+			cfs = append(cfs, cf.CustomField)
+		}
+	}
+
+	writePage(w, r, len(cfs), func(start, end int) interface{} {
+		return cfs[start:end]
+	})
+}
+
+func (s *Server) getCustomFieldSettings(w http.ResponseWriter, r *http.Request, args []string) {
+	proj := s.findProject(args[0])
+	if proj == nil {
+		writeError(w, http.StatusNotFound, "project: Unknown object")
+		return
+	}
+
+	settings := []*customFieldSetting{}
+	for _, setting := range s.customFieldSettings {
+		if setting.Project.GID == proj.GID {
+			settings = append(settings, setting)
+		}
+	}
+
+	writePage(w, r, len(settings), func(start, end int) interface{} {
+		return settings[start:end]
+	})
+}
+
+// Must be called with s.mu already locked
+func (s *Server) findCustomField(gid string) *customField {
+	for _, cf := range s.customFields {
+		if cf.GID == gid {
+			return cf
+		}
+	}
+
+	return nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) setCustomFields(t *Task, raw json.RawMessage) error {
+	values := map[string]json.RawMessage{}
+
+	err := json.Unmarshal(raw, &values)
+	if err != nil {
+		return err
+	}
+
+	for gid, val := range values {
+		def := s.findCustomField(gid)
+
+		cf := t.customField(gid)
+		if cf == nil {
+			if def == nil {
+				return fmt.Errorf("Custom field %s is not on this task", gid)
+			}
+
+			cf = &client.CustomField{
+				GID:             def.GID,
+				Name:            def.Name,
+				Type:            def.Type,
+				ResourceSubtype: def.ResourceSubtype,
+			}
+			t.CustomFields = append(t.CustomFields, cf)
+		}
+
+		err = s.setCustomFieldValue(cf, def, val)
+		if err != nil {
+			return fmt.Errorf("%s: %s", gid, err)
+		}
+	}
+
+	return nil
+}
+
+// setCustomFieldValue stores raw in cf. def may be nil for fields added
+// directly to fixture tasks, in which case enum options have no names.
+//
+// Must be called with s.mu already locked
+func (s *Server) setCustomFieldValue(cf *client.CustomField, def *customField, raw json.RawMessage) error {
+	cf.DisplayValue = nil
+	cf.TextValue = nil
+	cf.NumberValue = nil
+	cf.EnumValue = nil
+	cf.MultiEnumValues = nil
+	cf.DateValue = nil
+	cf.PeopleValue = nil
+
+	if string(raw) == "null" {
+		return nil
+	}
+
+	switch cf.ResourceSubtype {
+	case "text":
+		err := json.Unmarshal(raw, &cf.TextValue)
+		if err != nil {
+			return err
+		}
+		cf.DisplayValue = cf.TextValue
+
+	case "number":
+		err := json.Unmarshal(raw, &cf.NumberValue)
+		if err != nil {
+			return err
+		}
+		display := strconv.FormatFloat(*cf.NumberValue, 'f', -1, 64)
+		cf.DisplayValue = &display
+
+	case "enum":
+		gid := ""
+		err := json.Unmarshal(raw, &gid)
+		if err != nil {
+			return err
+		}
+
+		opt, err := enumOption(def, gid)
+		if err != nil {
+			return err
+		}
+
+		cf.EnumValue = opt
+		cf.DisplayValue = &opt.Name
+
+	case "multi_enum":
+		gids := []string{}
+		err := json.Unmarshal(raw, &gids)
+		if err != nil {
+			return err
+		}
+
+		for _, gid := range gids {
+			opt, err := enumOption(def, gid)
+			if err != nil {
+				return err
+			}
+
+			cf.MultiEnumValues = append(cf.MultiEnumValues, opt)
+		}
+
+	case "date":
+		err := json.Unmarshal(raw, &cf.DateValue)
+		if err != nil {
+			return err
+		}
+
+		display := cf.DateValue.Date
+		if cf.DateValue.DateTime != "" {
+			display = cf.DateValue.DateTime
+		}
+		cf.DisplayValue = &display
+
+	case "people":
+		gids := []string{}
+		err := json.Unmarshal(raw, &gids)
+		if err != nil {
+			return err
+		}
+
+		names := []string{}
+		for _, gid := range gids {
+			u := s.findUser(gid)
+			if u == nil {
+				return fmt.Errorf("Unknown user %s", gid)
+			}
+
+			cf.PeopleValue = append(cf.PeopleValue, u)
+			names = append(names, u.Name)
+		}
+
+		display := strings.Join(names, ", ")
+		cf.DisplayValue = &display
+
+	default:
+		return fmt.Errorf("Unsupported custom field type %s", cf.ResourceSubtype)
+	}
+
+	return nil
+}
+
+func enumOption(def *customField, gid string) (*client.EnumOption, error) {
+	if def == nil {
+		return &client.EnumOption{
+			GID:     gid,
+			Enabled: true,
+		}, nil
+	}
+
+	for _, opt := range def.EnumOptions {
+		if opt.GID == gid {
+			ret := *opt
+			return &ret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unknown enum option %s", gid)
+}
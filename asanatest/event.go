@@ -0,0 +1,130 @@
+package asanatest
+
+import "fmt"
+import "net/http"
+import "time"
+
+const maxEventsPerPage = 100
+
+type event struct {
+	resource string
+	data     map[string]interface{}
+}
+
+type syncErrorResponse struct {
+	Errors []*errorDetails `json:"errors"`
+	Sync   string          `json:"sync"`
+}
+
+type eventsResponse struct {
+	Data    []map[string]interface{} `json:"data"`
+	Sync    string                   `json:"sync"`
+	HasMore bool                     `json:"has_more"`
+}
+
+// ExpireSyncTokens invalidates all outstanding sync tokens, so the next
+// events request with any of them gets a 412.
+func (s *Server) ExpireSyncTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.syncEpoch++
+}
+
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request, _ []string) {
+	q := r.URL.Query()
+
+	resource := q.Get("resource")
+	if s.findProject(resource) == nil && s.findTask(resource) == nil {
+		writeError(w, http.StatusNotFound, "resource: Unknown object")
+		return
+	}
+
+	epoch, start := 0, 0
+	_, err := fmt.Sscanf(q.Get("sync"), "%d:%d", &epoch, &start)
+	if err != nil || epoch != s.syncEpoch || start > len(s.events) {
+		writeJSON(w, http.StatusPreconditionFailed, &syncErrorResponse{
+			Errors: []*errorDetails{
+				{Message: "Sync token invalid or too old. If you are attempting to keep resources in sync, you must fetch the full dataset for this query now and use the new sync token for the next sync."},
+			},
+			Sync: s.syncToken(len(s.events)),
+		})
+		return
+	}
+
+	resp := &eventsResponse{
+		Data: []map[string]interface{}{},
+	}
+
+	i := start
+	for ; i < len(s.events); i++ {
+		if len(resp.Data) >= maxEventsPerPage {
+			resp.HasMore = true
+			break
+		}
+
+		ev := s.events[i]
+		if ev.resource == resource {
+			resp.Data = append(resp.Data, ev.data)
+		}
+	}
+
+	resp.Sync = s.syncToken(i)
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) syncToken(index int) string {
+	return fmt.Sprintf("%d:%d", s.syncEpoch, index)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) emitTaskAdded(t *Task, sec *section) {
+	s.emit(sec.project.GID, "added", t, map[string]interface{}{
+		"gid":           sec.GID,
+		"name":          sec.Name,
+		"resource_type": "section",
+	}, nil)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) emitTaskChanged(t *Task, field string) {
+	change := map[string]interface{}{
+		"field":  field,
+		"action": "changed",
+	}
+
+	s.emit(t.GID, "changed", t, nil, change)
+
+	for _, existing := range t.Sections {
+		sec := s.findSection(existing.GID)
+		if sec != nil {
+			s.emit(sec.project.GID, "changed", t, nil, change)
+		}
+	}
+}
+
+// Must be called with s.mu already locked
+func (s *Server) emit(resource, action string, t *Task, parent map[string]interface{}, change map[string]interface{}) {
+	data := map[string]interface{}{
+		"action":     action,
+		"created_at": time.Now().UTC().Format(timeFormat),
+		"resource": map[string]interface{}{
+			"gid":           t.GID,
+			"name":          t.Name,
+			"resource_type": "task",
+		},
+		"parent": parent,
+		"change": change,
+		"user":   s.me,
+	}
+
+	ev := &event{
+		resource: resource,
+		data:     data,
+	}
+
+	s.events = append(s.events, ev)
+	s.deliver(ev)
+}
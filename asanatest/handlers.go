@@ -0,0 +1,590 @@
+package asanatest
+
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "reflect"
+import "time"
+
+import "github.com/firestuff/automana/client"
+
+type requestBody struct {
+	Data map[string]json.RawMessage `json:"data"`
+}
+
+func (s *Server) getWorkspaces(w http.ResponseWriter, r *http.Request, _ []string) {
+	writePage(w, r, len(s.workspaces), func(start, end int) interface{} {
+		return s.workspaces[start:end]
+	})
+}
+
+func (s *Server) getProjects(w http.ResponseWriter, r *http.Request, args []string) {
+	wrk := s.findWorkspace(args[0])
+	if wrk == nil {
+		writeError(w, http.StatusNotFound, "workspace: Unknown object")
+		return
+	}
+
+	projs := []*client.Project{}
+	for _, p := range s.projects {
+		if p.workspace == wrk && p.owner == nil {
+			projs = append(projs, p.Project)
+		}
+	}
+
+	writePage(w, r, len(projs), func(start, end int) interface{} {
+		return projs[start:end]
+	})
+}
+
+func (s *Server) getTags(w http.ResponseWriter, r *http.Request, args []string) {
+	wrk := s.findWorkspace(args[0])
+	if wrk == nil {
+		writeError(w, http.StatusNotFound, "workspace: Unknown object")
+		return
+	}
+
+	tags := []*client.Tag{}
+	for _, t := range s.tags {
+		if t.workspace == wrk {
+			tags = append(tags, t.Tag)
+		}
+	}
+
+	writePage(w, r, len(tags), func(start, end int) interface{} {
+		return tags[start:end]
+	})
+}
+
+func (s *Server) getTeams(w http.ResponseWriter, r *http.Request, args []string) {
+	wrk := s.findWorkspace(args[0])
+	if wrk == nil {
+		writeError(w, http.StatusNotFound, "workspace: Unknown object")
+		return
+	}
+
+	teams := []*client.Team{}
+	for _, t := range s.teams {
+		if t.workspace == wrk {
+			teams = append(teams, t.Team)
+		}
+	}
+
+	writePage(w, r, len(teams), func(start, end int) interface{} {
+		return teams[start:end]
+	})
+}
+
+func (s *Server) getMe(w http.ResponseWriter, r *http.Request, _ []string) {
+	if s.me == nil {
+		writeError(w, http.StatusNotFound, "user: Unknown object")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: s.me})
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request, args []string) {
+	u := s.findUser(args[0])
+	if u == nil {
+		writeError(w, http.StatusNotFound, "user: Unknown object")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: u})
+}
+
+// All users are members of every workspace
+func (s *Server) getUsers(w http.ResponseWriter, r *http.Request, args []string) {
+	wrk := s.findWorkspace(args[0])
+	if wrk == nil {
+		writeError(w, http.StatusNotFound, "workspace: Unknown object")
+		return
+	}
+
+	writePage(w, r, len(s.users), func(start, end int) interface{} {
+		return s.users[start:end]
+	})
+}
+
+func (s *Server) getUserTaskList(w http.ResponseWriter, r *http.Request, args []string) {
+	u := s.findUser(args[0])
+	if u == nil {
+		writeError(w, http.StatusNotFound, "user: Unknown object")
+		return
+	}
+
+	wrk := s.findWorkspace(r.URL.Query().Get("workspace"))
+	if wrk == nil {
+		writeError(w, http.StatusBadRequest, "workspace: Missing input")
+		return
+	}
+
+	utl := s.userTaskList(wrk, u)
+	if utl == nil {
+		writeError(w, http.StatusNotFound, "user_task_list: Unknown object")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: utl.Project})
+}
+
+func (s *Server) getSections(w http.ResponseWriter, r *http.Request, args []string) {
+	proj := s.findProject(args[0])
+	if proj == nil {
+		writeError(w, http.StatusNotFound, "project: Unknown object")
+		return
+	}
+
+	secs := []*client.Section{}
+	for _, sec := range s.sections {
+		if sec.project == proj {
+			secs = append(secs, sec.Section)
+		}
+	}
+
+	writePage(w, r, len(secs), func(start, end int) interface{} {
+		return secs[start:end]
+	})
+}
+
+func (s *Server) getSectionTasks(w http.ResponseWriter, r *http.Request, args []string) {
+	sec := s.findSection(args[0])
+	if sec == nil {
+		writeError(w, http.StatusNotFound, "section: Unknown object")
+		return
+	}
+
+	tasks := []*Task{}
+	for _, t := range s.tasks {
+		if t.inSection(sec.GID) {
+			tasks = append(tasks, t)
+		}
+	}
+
+	writePage(w, r, len(tasks), func(start, end int) interface{} {
+		return s.renderTasks(tasks[start:end])
+	})
+}
+
+func (s *Server) addTaskToSection(w http.ResponseWriter, r *http.Request, args []string) {
+	sec := s.findSection(args[0])
+	if sec == nil {
+		writeError(w, http.StatusNotFound, "section: Unknown object")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	gid := ""
+	err = json.Unmarshal(body.Data["task"], &gid)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "task: Missing input")
+		return
+	}
+
+	t := s.findTask(gid)
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	anchors := map[string]*Task{}
+	for _, key := range []string{"insert_before", "insert_after"} {
+		raw, found := body.Data[key]
+		if !found {
+			continue
+		}
+
+		anchorGID := ""
+		_ = json.Unmarshal(raw, &anchorGID)
+		anchor := s.findTask(anchorGID)
+		if anchor == nil || anchor == t || !anchor.inSection(sec.GID) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: Task is not in this section", key))
+			return
+		}
+		anchors[key] = anchor
+	}
+
+	if len(anchors) > 1 {
+		writeError(w, http.StatusBadRequest, "Only one of insert_before or insert_after may be set")
+		return
+	}
+
+	s.moveToSection(t, sec)
+
+	if anchor, found := anchors["insert_before"]; found {
+		s.reorderTask(t, anchor, false)
+	}
+
+	if anchor, found := anchors["insert_after"]; found {
+		s.reorderTask(t, anchor, true)
+	}
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: map[string]interface{}{}})
+}
+
+// reorderTask moves t just before or after anchor. Tasks within a section
+// are listed in the order they appear in s.tasks.
+//
+// Must be called with s.mu already locked
+func (s *Server) reorderTask(t, anchor *Task, after bool) {
+	tasks := []*Task{}
+	for _, existing := range s.tasks {
+		if existing == t {
+			continue
+		}
+
+		if existing == anchor && after {
+			tasks = append(tasks, existing, t)
+			continue
+		}
+
+		if existing == anchor {
+			tasks = append(tasks, t)
+		}
+
+		tasks = append(tasks, existing)
+	}
+	s.tasks = tasks
+}
+
+func (s *Server) updateTask(w http.ResponseWriter, r *http.Request, args []string) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fields := map[string]interface{}{
+		"name":       &t.Name,
+		"start_on":   &t.StartOn,
+		"due_on":     &t.DueOn,
+		"due_at":     &t.DueAt,
+		"html_notes": &t.HTMLNotes,
+		"completed":  &t.Completed,
+	}
+
+	setters := map[string]func(json.RawMessage) error{
+		"assignee_section": func(raw json.RawMessage) error {
+			return s.setAssigneeSection(t, raw)
+		},
+		"assignee": func(raw json.RawMessage) error {
+			return s.setAssignee(t, raw)
+		},
+		"custom_fields": func(raw json.RawMessage) error {
+			return s.setCustomFields(t, raw)
+		},
+	}
+
+	for key, raw := range body.Data {
+		if setter, found := setters[key]; found {
+			err = setter(raw)
+		} else if field, found := fields[key]; found {
+			err = unmarshalNullable(raw, field)
+		} else {
+			err = fmt.Errorf("Unsupported field")
+		}
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: %s", key, err))
+			return
+		}
+
+		if key != "assignee_section" {
+			s.emitTaskChanged(t, key)
+			s.addChangeStory(t, key)
+		}
+	}
+
+	s.touch(t)
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: s.renderTask(t)})
+}
+
+// Must be called with s.mu already locked
+func (s *Server) setAssigneeSection(t *Task, raw json.RawMessage) error {
+	gid := ""
+
+	err := unmarshalNullableGID(raw, &gid)
+	if err != nil {
+		return err
+	}
+
+	if gid == "" {
+		return nil
+	}
+
+	sec := s.findSection(gid)
+	if sec == nil {
+		return fmt.Errorf("Unknown object")
+	}
+
+	s.moveToSection(t, sec)
+
+	return nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) setAssignee(t *Task, raw json.RawMessage) error {
+	gid := ""
+
+	err := unmarshalNullableGID(raw, &gid)
+	if err != nil {
+		return err
+	}
+
+	if gid == "" {
+		t.Assignee = nil
+		return nil
+	}
+
+	u := s.findUser(gid)
+	if u == nil {
+		return fmt.Errorf("Unknown object")
+	}
+
+	t.Assignee = u
+
+	return nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) moveToSection(t *Task, sec *section) {
+	var old *client.Section
+
+	secs := []*client.Section{}
+	for _, existing := range t.Sections {
+		other := s.findSection(existing.GID)
+		if other != nil && other.project == sec.project {
+			old = existing
+			continue
+		}
+		secs = append(secs, existing)
+	}
+	t.Sections = append(secs, sec.Section)
+
+	// Asana doesn't record moves within My Tasks
+	if sec.project.owner == nil {
+		if old == nil {
+			st := s.addStory(t, "added_to_project", fmt.Sprintf("added to %s", sec.project.Name))
+			st.Project = sec.project.Project
+		} else if old.GID != sec.GID {
+			st := s.addStory(t, "section_changed", fmt.Sprintf("moved this task from %s to %s", old.Name, sec.Name))
+			st.OldSection = old
+			st.NewSection = sec.Section
+			st.Project = sec.project.Project
+		}
+	}
+
+	s.touch(t)
+	s.emitTaskAdded(t, sec)
+}
+
+func readBody(r *http.Request) (*requestBody, error) {
+	body := &requestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body.Data == nil {
+		return nil, fmt.Errorf("data: Missing input")
+	}
+
+	return body, nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) userTaskList(wrk *client.Workspace, u *client.User) *project {
+	for _, p := range s.projects {
+		if p.workspace == wrk && p.owner == u {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) assigneeSection(t *Task) *client.Section {
+	if t.Assignee == nil {
+		return nil
+	}
+
+	for _, existing := range t.Sections {
+		sec := s.findSection(existing.GID)
+		if sec != nil && sec.project.owner == t.Assignee {
+			return sec.Section
+		}
+	}
+
+	return nil
+}
+
+// touch updates modified_at and completed_at after a change
+//
+// Must be called with s.mu already locked
+func (s *Server) touch(t *Task) {
+	now := time.Now().UTC().Format(timeFormat)
+
+	t.ModifiedAt = now
+
+	if !t.Completed {
+		t.CompletedAt = ""
+	} else if t.CompletedAt == "" {
+		t.CompletedAt = now
+	}
+}
+
+// Must be called with s.mu already locked
+func (s *Server) renderTask(t *Task) map[string]interface{} {
+	ret := map[string]interface{}{
+		"gid":              t.GID,
+		"name":             t.Name,
+		"resource_subtype": t.ResourceSubtype,
+		"created_at":       t.CreatedAt,
+		"modified_at":      t.ModifiedAt,
+		"html_notes":       t.HTMLNotes,
+		"completed":        t.Completed,
+		"completed_at":     nullable(t.CompletedAt),
+		"start_on":         nullable(t.StartOn),
+		"due_on":           nullable(t.DueOn),
+		"due_at":           nullable(t.DueAt),
+		"assignee":         nil,
+		"parent":           nil,
+		"projects":         []*client.Project{},
+		"memberships":      []map[string]interface{}{},
+		"tags":             t.Tags,
+		"followers":        t.Followers,
+		"custom_fields":    t.CustomFields,
+		"permalink_url":    fmt.Sprintf("https://app.asana.com/0/0/%s", t.GID),
+	}
+
+	if t.Assignee != nil {
+		ret["assignee"] = t.Assignee
+	}
+
+	numSubtasks := 0
+	for _, other := range s.tasks {
+		if other.Parent == t.GID {
+			numSubtasks++
+		}
+	}
+	ret["num_subtasks"] = numSubtasks
+
+	parent := s.findTask(t.Parent)
+	if parent != nil {
+		ret["parent"] = map[string]string{
+			"gid":  parent.GID,
+			"name": parent.Name,
+		}
+	}
+
+	projs := []*client.Project{}
+	memberships := []map[string]interface{}{}
+	for _, existing := range t.Sections {
+		sec := s.findSection(existing.GID)
+		if sec == nil || sec.project.owner != nil {
+			// User task lists aren't memberships
+			continue
+		}
+
+		projs = append(projs, sec.project.Project)
+		memberships = append(memberships, map[string]interface{}{
+			"project": sec.project.Project,
+			"section": sec.Section,
+		})
+	}
+	ret["projects"] = projs
+	ret["memberships"] = memberships
+
+	sec := s.assigneeSection(t)
+	if sec != nil {
+		ret["assignee_section"] = map[string]string{"gid": sec.GID}
+	} else {
+		ret["assignee_section"] = nil
+	}
+
+	return ret
+}
+
+// Must be called with s.mu already locked
+func (s *Server) renderTasks(tasks []*Task) []map[string]interface{} {
+	ret := []map[string]interface{}{}
+	for _, t := range tasks {
+		ret = append(ret, s.renderTask(t))
+	}
+	return ret
+}
+
+func (t *Task) inSection(gid string) bool {
+	for _, sec := range t.Sections {
+		if sec.GID == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Task) hasTag(gid string) bool {
+	for _, tag := range t.Tags {
+		if tag.GID == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
+
+func (t *Task) hasFollower(gid string) bool {
+	for _, u := range t.Followers {
+		if u.GID == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Task) customField(gid string) *client.CustomField {
+	for _, cf := range t.CustomFields {
+		if cf.GID == gid {
+			return cf
+		}
+	}
+
+	return nil
+}
+
+// unmarshalNullable treats null as the zero value, unlike json.Unmarshal
+// which leaves the field untouched
+func unmarshalNullable(raw json.RawMessage, field interface{}) error {
+	if string(raw) == "null" {
+		v := reflect.ValueOf(field).Elem()
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	return json.Unmarshal(raw, field)
+}
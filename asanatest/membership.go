@@ -0,0 +1,177 @@
+package asanatest
+
+import "encoding/json"
+import "fmt"
+import "net/http"
+
+import "github.com/firestuff/automana/client"
+
+func (s *Server) addTag(w http.ResponseWriter, r *http.Request, args []string) {
+	s.changeTag(w, r, args, func(t *Task, tag *tag) {
+		if !t.hasTag(tag.GID) {
+			t.Tags = append(t.Tags, tag.Tag)
+		}
+	})
+}
+
+func (s *Server) removeTag(w http.ResponseWriter, r *http.Request, args []string) {
+	s.changeTag(w, r, args, func(t *Task, tag *tag) {
+		tags := []*client.Tag{}
+		for _, existing := range t.Tags {
+			if existing.GID != tag.GID {
+				tags = append(tags, existing)
+			}
+		}
+		t.Tags = tags
+	})
+}
+
+func (s *Server) addTaskToProject(w http.ResponseWriter, r *http.Request, args []string) {
+	s.changeProject(w, r, args, func(t *Task, proj *project) {
+		for _, existing := range t.Sections {
+			sec := s.findSection(existing.GID)
+			if sec != nil && sec.project == proj {
+				return
+			}
+		}
+
+		sec := s.firstSection(proj)
+		if sec != nil {
+			s.moveToSection(t, sec)
+		}
+	})
+}
+
+func (s *Server) removeTaskFromProject(w http.ResponseWriter, r *http.Request, args []string) {
+	s.changeProject(w, r, args, func(t *Task, proj *project) {
+		secs := []*client.Section{}
+		for _, existing := range t.Sections {
+			sec := s.findSection(existing.GID)
+			if sec != nil && sec.project == proj {
+				s.emit(proj.GID, "removed", t, nil, nil)
+				st := s.addStory(t, "removed_from_project", fmt.Sprintf("removed this task from %s", proj.Name))
+				st.Project = proj.Project
+				continue
+			}
+			secs = append(secs, existing)
+		}
+		t.Sections = secs
+	})
+}
+
+func (s *Server) addFollowers(w http.ResponseWriter, r *http.Request, args []string) {
+	s.changeFollowers(w, r, args, func(t *Task, u *client.User) {
+		if !t.hasFollower(u.GID) {
+			t.Followers = append(t.Followers, u)
+		}
+	})
+}
+
+func (s *Server) removeFollowers(w http.ResponseWriter, r *http.Request, args []string) {
+	s.changeFollowers(w, r, args, func(t *Task, u *client.User) {
+		followers := []*client.User{}
+		for _, existing := range t.Followers {
+			if existing.GID != u.GID {
+				followers = append(followers, existing)
+			}
+		}
+		t.Followers = followers
+	})
+}
+
+// Must be called with s.mu already locked
+func (s *Server) changeTag(w http.ResponseWriter, r *http.Request, args []string, change func(*Task, *tag)) {
+	t, body := s.taskAction(w, r, args)
+	if t == nil {
+		return
+	}
+
+	gid := ""
+	_ = json.Unmarshal(body.Data["tag"], &gid)
+	tag := s.findTag(gid)
+	if tag == nil {
+		writeError(w, http.StatusNotFound, "tag: Unknown object")
+		return
+	}
+
+	change(t, tag)
+	s.touch(t)
+	s.emitTaskChanged(t, "tags")
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: map[string]interface{}{}})
+}
+
+// Must be called with s.mu already locked
+func (s *Server) changeProject(w http.ResponseWriter, r *http.Request, args []string, change func(*Task, *project)) {
+	t, body := s.taskAction(w, r, args)
+	if t == nil {
+		return
+	}
+
+	gid := ""
+	_ = json.Unmarshal(body.Data["project"], &gid)
+	proj := s.findProject(gid)
+	if proj == nil || proj.owner != nil {
+		writeError(w, http.StatusNotFound, "project: Unknown object")
+		return
+	}
+
+	change(t, proj)
+	s.touch(t)
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: map[string]interface{}{}})
+}
+
+// Must be called with s.mu already locked
+func (s *Server) changeFollowers(w http.ResponseWriter, r *http.Request, args []string, change func(*Task, *client.User)) {
+	t, body := s.taskAction(w, r, args)
+	if t == nil {
+		return
+	}
+
+	ids := []string{}
+	err := json.Unmarshal(body.Data["followers"], &ids)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "followers: Missing input")
+		return
+	}
+
+	users := []*client.User{}
+	for _, id := range ids {
+		u := s.findUser(id)
+		if u == nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("followers: Unknown user %s", id))
+			return
+		}
+		users = append(users, u)
+	}
+
+	for _, u := range users {
+		change(t, u)
+	}
+
+	s.touch(t)
+	s.emitTaskChanged(t, "followers")
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: s.renderTask(t)})
+}
+
+// taskAction looks up the task and reads the body for a tasks/{gid}/{action}
+// request, writing an error and returning nil on failure
+//
+// Must be called with s.mu already locked
+func (s *Server) taskAction(w http.ResponseWriter, r *http.Request, args []string) (*Task, *requestBody) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return nil, nil
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, nil
+	}
+
+	return t, body
+}
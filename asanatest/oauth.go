@@ -0,0 +1,152 @@
+package asanatest
+
+import "fmt"
+import "net/http"
+import "net/url"
+import "time"
+
+import "github.com/firestuff/automana/client"
+
+const oauthClientID = "asanatest-client"
+const oauthClientSecret = "asanatest-secret"
+
+type oauthState struct {
+	tokenLifetime time.Duration
+	codes         map[string]bool
+	refresh       map[string]bool
+	issued        int
+}
+
+// OAuthConfig returns a config for the fake's OAuth app, with AuthURL and
+// TokenURL pointing at the fake. The fake AuthURL approves immediately and
+// redirects to redirectURL with a fresh code.
+func (s *Server) OAuthConfig(redirectURL string) *client.OAuthConfig {
+	oc := client.NewOAuthConfig(oauthClientID, oauthClientSecret, redirectURL)
+	oc.AuthURL = fmt.Sprintf("%s/-/oauth_authorize", s.srv.URL)
+	oc.TokenURL = fmt.Sprintf("%s/-/oauth_token", s.srv.URL)
+	return oc
+}
+
+// AuthCode issues a single-use authorization code
+func (s *Server) AuthCode() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.authCode()
+}
+
+// SetTokenLifetime sets expires_in for tokens issued from now on
+func (s *Server) SetTokenLifetime(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.oauth.tokenLifetime = d
+}
+
+// RevokeToken makes the current access token fail with 401, as if it had
+// expired early. Refresh tokens keep working.
+func (s *Server) RevokeToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Token = fmt.Sprintf("asanatest-revoked-%d", s.oauth.issued)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) serveOAuth(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/-/oauth_authorize":
+		s.oauthAuthorize(w, r)
+
+	case "/-/oauth_token":
+		s.oauthToken(w, r)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Must be called with s.mu already locked
+func (s *Server) oauthAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != oauthClientID || q.Get("response_type") != "code" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	values := redirect.Query()
+	values.Set("code", s.authCode())
+	values.Set("state", q.Get("state"))
+	redirect.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) oauthToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, "invalid_request")
+		return
+	}
+
+	if r.PostForm.Get("client_id") != oauthClientID || r.PostForm.Get("client_secret") != oauthClientSecret {
+		writeOAuthError(w, "invalid_client")
+		return
+	}
+
+	resp := map[string]interface{}{}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		if !s.oauth.codes[code] {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		delete(s.oauth.codes, code)
+
+		refresh := fmt.Sprintf("asanatest-refresh-%s", code)
+		s.oauth.refresh[refresh] = true
+		resp["refresh_token"] = refresh
+
+	case "refresh_token":
+		if !s.oauth.refresh[r.PostForm.Get("refresh_token")] {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+
+	default:
+		writeOAuthError(w, "unsupported_grant_type")
+		return
+	}
+
+	s.oauth.issued++
+	s.Token = fmt.Sprintf("asanatest-token-%d", s.oauth.issued)
+
+	resp["access_token"] = s.Token
+	resp["token_type"] = "bearer"
+	resp["expires_in"] = int(s.oauth.tokenLifetime / time.Second)
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) authCode() string {
+	code := s.gid()
+	s.oauth.codes[code] = true
+	return code
+}
+
+func writeOAuthError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error": code,
+	})
+}
@@ -0,0 +1,425 @@
+package asanatest
+
+import "fmt"
+import "net/http"
+import "net/url"
+import "sort"
+import "strconv"
+import "strings"
+import "time"
+
+import "github.com/firestuff/automana/client"
+
+// A predicate returns whether t matches a single search parameter value
+type predicate func(*Server, *Task, string) (bool, error)
+
+var searchPredicates = map[string]predicate{
+	"text":                matchText,
+	"resource_subtype":    func(_ *Server, t *Task, v string) (bool, error) { return t.ResourceSubtype == v, nil },
+	"assignee.any":        anyOf(func(_ *Server, t *Task, gid string) bool { return t.Assignee != nil && t.Assignee.GID == gid }),
+	"assignee.not":        noneOf(func(_ *Server, t *Task, gid string) bool { return t.Assignee != nil && t.Assignee.GID == gid }),
+	"followers.any":       anyOf(func(_ *Server, t *Task, gid string) bool { return t.hasFollower(gid) }),
+	"projects.any":        anyOf((*Server).inProject),
+	"projects.all":        allOf((*Server).inProject),
+	"projects.not":        noneOf((*Server).inProject),
+	"sections.any":        anyOf(func(_ *Server, t *Task, gid string) bool { return t.inSection(gid) }),
+	"sections.all":        allOf(func(_ *Server, t *Task, gid string) bool { return t.inSection(gid) }),
+	"sections.not":        noneOf(func(_ *Server, t *Task, gid string) bool { return t.inSection(gid) }),
+	"tags.any":            anyOf(func(_ *Server, t *Task, gid string) bool { return t.hasTag(gid) }),
+	"tags.all":            allOf(func(_ *Server, t *Task, gid string) bool { return t.hasTag(gid) }),
+	"tags.not":            noneOf(func(_ *Server, t *Task, gid string) bool { return t.hasTag(gid) }),
+	"teams.any":           anyOf((*Server).inTeam),
+	"completed":           matchBool(func(_ *Server, t *Task) bool { return t.Completed }),
+	"is_blocked":          matchBool((*Server).isBlocked),
+	"is_blocking":         matchBool((*Server).isBlocking),
+	"has_attachment":      matchBool(func(_ *Server, t *Task) bool { return t.HasAttachment }),
+	"is_subtask":          matchBool(func(_ *Server, t *Task) bool { return t.Parent != "" }),
+	"due_on":              matchDueOn,
+	"due_on.before":       timeCompare(func(t *Task) string { return t.DueOn }, -1),
+	"due_on.after":        timeCompare(func(t *Task) string { return t.DueOn }, 1),
+	"due_at.before":       timeCompare(func(t *Task) string { return t.DueAt }, -1),
+	"due_at.after":        timeCompare(func(t *Task) string { return t.DueAt }, 1),
+	"start_on.before":     timeCompare(func(t *Task) string { return t.StartOn }, -1),
+	"start_on.after":      timeCompare(func(t *Task) string { return t.StartOn }, 1),
+	"created_at.before":   timeCompare(func(t *Task) string { return t.CreatedAt }, -1),
+	"created_at.after":    timeCompare(func(t *Task) string { return t.CreatedAt }, 1),
+	"modified_at.before":  timeCompare(func(t *Task) string { return t.ModifiedAt }, -1),
+	"modified_at.after":   timeCompare(func(t *Task) string { return t.ModifiedAt }, 1),
+	"completed_at.before": timeCompare(func(t *Task) string { return t.CompletedAt }, -1),
+	"completed_at.after":  timeCompare(func(t *Task) string { return t.CompletedAt }, 1),
+}
+
+// custom_fields.{gid}.{suffix}
+var customFieldPredicates = map[string]func(gid string) predicate{
+	"value":        matchCustomFieldValue,
+	"less_than":    matchCustomFieldNumber(-1),
+	"greater_than": matchCustomFieldNumber(1),
+	"is_set":       matchCustomFieldIsSet,
+}
+
+// Parameters that shape the response rather than filter it
+var searchIgnored = map[string]bool{
+	"limit":          true,
+	"opt_fields":     true,
+	"sort_by":        true,
+	"sort_ascending": true,
+}
+
+func (s *Server) searchTasks(w http.ResponseWriter, r *http.Request, args []string) {
+	wrk := s.findWorkspace(args[0])
+	if wrk == nil {
+		writeError(w, http.StatusNotFound, "workspace: Unknown object")
+		return
+	}
+
+	q := r.URL.Query()
+
+	err := validateSearch(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tasks := []*Task{}
+
+	for _, t := range s.tasks {
+		if t.workspace != wrk {
+			continue
+		}
+
+		ok, err := s.matchSearch(t, q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if ok {
+			tasks = append(tasks, t)
+		}
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if q.Get("sort_ascending") == "true" {
+			return tasks[i].CreatedAt < tasks[j].CreatedAt
+		}
+		return tasks[i].CreatedAt > tasks[j].CreatedAt
+	})
+
+	limit := 100
+	if q.Get("limit") != "" {
+		limit, err = strconv.Atoi(q.Get("limit"))
+		if err != nil || limit < 1 || limit > 100 {
+			writeError(w, http.StatusBadRequest, "limit: Not a valid limit")
+			return
+		}
+	}
+
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+
+	// Search never returns next_page; callers page with created_at.after
+	writeJSON(w, http.StatusOK, &listResponse{Data: s.renderTasks(tasks)})
+}
+
+func validateSearch(q url.Values) error {
+	for key := range q {
+		if searchIgnored[key] {
+			continue
+		}
+
+		_, found := predicateFor(key)
+		if !found {
+			return fmt.Errorf("%s: Unsupported search parameter", key)
+		}
+	}
+
+	return nil
+}
+
+func predicateFor(key string) (predicate, bool) {
+	pred, found := searchPredicates[key]
+	if found {
+		return pred, true
+	}
+
+	parts := strings.Split(key, ".")
+	if len(parts) == 3 && parts[0] == "custom_fields" {
+		cfPred, found := customFieldPredicates[parts[2]]
+		if found {
+			return cfPred(parts[1]), true
+		}
+	}
+
+	return nil, false
+}
+
+// Must be called with s.mu already locked
+func (s *Server) matchSearch(t *Task, q url.Values) (bool, error) {
+	for key, vals := range q {
+		pred, found := predicateFor(key)
+		if !found {
+			continue
+		}
+
+		for _, val := range vals {
+			ok, err := pred(s, t, val)
+			if err != nil {
+				return false, err
+			}
+
+			if !ok {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) inProject(t *Task, gid string) bool {
+	for _, existing := range t.Sections {
+		sec := s.findSection(existing.GID)
+		if sec != nil && sec.project.GID == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Must be called with s.mu already locked
+func (s *Server) inTeam(t *Task, gid string) bool {
+	for _, existing := range t.Sections {
+		sec := s.findSection(existing.GID)
+		if sec != nil && sec.project.team != nil && sec.project.team.GID == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Must be called with s.mu already locked
+func (s *Server) isBlocked(t *Task) bool {
+	for _, gid := range t.Dependencies {
+		dep := s.findTask(gid)
+		if dep != nil && !dep.Completed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Must be called with s.mu already locked
+func (s *Server) isBlocking(t *Task) bool {
+	if t.Completed {
+		return false
+	}
+
+	for _, other := range s.tasks {
+		for _, gid := range other.Dependencies {
+			if gid == t.GID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func anyOf(f func(*Server, *Task, string) bool) predicate {
+	return func(s *Server, t *Task, val string) (bool, error) {
+		for _, gid := range strings.Split(val, ",") {
+			if f(s, t, gid) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+func allOf(f func(*Server, *Task, string) bool) predicate {
+	return func(s *Server, t *Task, val string) (bool, error) {
+		for _, gid := range strings.Split(val, ",") {
+			if !f(s, t, gid) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
+
+func noneOf(f func(*Server, *Task, string) bool) predicate {
+	any := anyOf(f)
+	return func(s *Server, t *Task, val string) (bool, error) {
+		ok, err := any(s, t, val)
+		return !ok, err
+	}
+}
+
+func matchBool(f func(*Server, *Task) bool) predicate {
+	return func(s *Server, t *Task, val string) (bool, error) {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return false, fmt.Errorf("%s: Not a boolean", val)
+		}
+
+		return f(s, t) == b, nil
+	}
+}
+
+// timeCompare matches tasks whose field compares to the bound as sign
+// (-1 for before, 1 for after). Tasks with the field unset never match.
+func timeCompare(field func(*Task) string, sign int) predicate {
+	return func(_ *Server, t *Task, bound string) (bool, error) {
+		v := field(t)
+		if v == "" {
+			return false, nil
+		}
+
+		cmp, err := compareTimes(v, bound)
+		if err != nil {
+			return false, err
+		}
+
+		return cmp == sign, nil
+	}
+}
+
+// compareTimes compares dates or RFC3339 times, returning -1, 0 or 1
+func compareTimes(a, b string) (int, error) {
+	if len(a) == len("2006-01-02") && len(b) == len("2006-01-02") {
+		return strings.Compare(a, b), nil
+	}
+
+	ta, err := parseTime(a)
+	if err != nil {
+		return 0, err
+	}
+
+	tb, err := parseTime(b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case ta.Before(tb):
+		return -1, nil
+	case ta.After(tb):
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if len(s) == len("2006-01-02") {
+		return time.Parse("2006-01-02", s)
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func matchText(_ *Server, t *Task, val string) (bool, error) {
+	needle := strings.ToLower(val)
+	return strings.Contains(strings.ToLower(t.Name), needle) || strings.Contains(strings.ToLower(t.HTMLNotes), needle), nil
+}
+
+func matchDueOn(_ *Server, t *Task, val string) (bool, error) {
+	if val == "null" {
+		return t.DueOn == "", nil
+	}
+
+	return t.DueOn == val, nil
+}
+
+func matchCustomFieldValue(gid string) predicate {
+	return func(_ *Server, t *Task, val string) (bool, error) {
+		cf := t.customField(gid)
+		if cf == nil {
+			return false, nil
+		}
+
+		switch {
+		case cf.TextValue != nil:
+			return *cf.TextValue == val, nil
+
+		case cf.NumberValue != nil:
+			n, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return false, fmt.Errorf("custom_fields.%s.value: Not a number", gid)
+			}
+			return *cf.NumberValue == n, nil
+
+		case cf.EnumValue != nil:
+			return cf.EnumValue.GID == val, nil
+
+		case len(cf.MultiEnumValues) > 0:
+			for _, opt := range cf.MultiEnumValues {
+				if opt.GID == val {
+					return true, nil
+				}
+			}
+			return false, nil
+
+		case len(cf.PeopleValue) > 0:
+			for _, u := range cf.PeopleValue {
+				if u.GID == val {
+					return true, nil
+				}
+			}
+			return false, nil
+
+		default:
+			return false, nil
+		}
+	}
+}
+
+func matchCustomFieldNumber(sign int) func(string) predicate {
+	return func(gid string) predicate {
+		return func(_ *Server, t *Task, val string) (bool, error) {
+			bound, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return false, fmt.Errorf("custom_fields.%s: Not a number", gid)
+			}
+
+			cf := t.customField(gid)
+			if cf == nil || cf.NumberValue == nil {
+				return false, nil
+			}
+
+			if sign < 0 {
+				return *cf.NumberValue < bound, nil
+			}
+			return *cf.NumberValue > bound, nil
+		}
+	}
+}
+
+func matchCustomFieldIsSet(gid string) predicate {
+	return func(_ *Server, t *Task, val string) (bool, error) {
+		isSet, err := strconv.ParseBool(val)
+		if err != nil {
+			return false, fmt.Errorf("custom_fields.%s.is_set: Not a boolean", gid)
+		}
+
+		return customFieldIsSet(t.customField(gid)) == isSet, nil
+	}
+}
+
+func customFieldIsSet(cf *client.CustomField) bool {
+	if cf == nil {
+		return false
+	}
+
+	return cf.TextValue != nil ||
+		cf.NumberValue != nil ||
+		cf.EnumValue != nil ||
+		len(cf.MultiEnumValues) > 0 ||
+		cf.DateValue != nil ||
+		len(cf.PeopleValue) > 0
+}
@@ -0,0 +1,179 @@
+package asanatest
+
+import "encoding/json"
+import "net/http"
+
+func (s *Server) createSection(w http.ResponseWriter, r *http.Request, args []string) {
+	proj := s.findProject(args[0])
+	if proj == nil {
+		writeError(w, http.StatusNotFound, "project: Unknown object")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := ""
+	err = json.Unmarshal(body.Data["name"], &name)
+	if err != nil || name == "" {
+		writeError(w, http.StatusBadRequest, "name: Missing input")
+		return
+	}
+
+	sec := s.addSection(proj.Project, name)
+
+	writeJSON(w, http.StatusCreated, &dataResponse{Data: sec})
+}
+
+func (s *Server) updateSection(w http.ResponseWriter, r *http.Request, args []string) {
+	sec := s.findSection(args[0])
+	if sec == nil {
+		writeError(w, http.StatusNotFound, "section: Unknown object")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := ""
+	err = json.Unmarshal(body.Data["name"], &name)
+	if err != nil || name == "" {
+		writeError(w, http.StatusBadRequest, "name: Missing input")
+		return
+	}
+
+	sec.Name = name
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: sec.Section})
+}
+
+func (s *Server) deleteSection(w http.ResponseWriter, r *http.Request, args []string) {
+	sec := s.findSection(args[0])
+	if sec == nil {
+		writeError(w, http.StatusNotFound, "section: Unknown object")
+		return
+	}
+
+	for _, t := range s.tasks {
+		if t.inSection(sec.GID) {
+			writeError(w, http.StatusBadRequest, "section: Section must be empty to be deleted")
+			return
+		}
+	}
+
+	if s.firstSection(sec.project) == sec && s.nextSection(sec) == nil {
+		writeError(w, http.StatusBadRequest, "section: Cannot delete the last section in a project")
+		return
+	}
+
+	s.removeSection(sec)
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: map[string]interface{}{}})
+}
+
+func (s *Server) insertSection(w http.ResponseWriter, r *http.Request, args []string) {
+	proj := s.findProject(args[0])
+	if proj == nil {
+		writeError(w, http.StatusNotFound, "project: Unknown object")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	gids := map[string]string{}
+	for _, key := range []string{"section", "before_section", "after_section"} {
+		raw, found := body.Data[key]
+		if !found {
+			continue
+		}
+
+		gid := ""
+		err = json.Unmarshal(raw, &gid)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, key+": "+err.Error())
+			return
+		}
+		gids[key] = gid
+	}
+
+	sec := s.findSection(gids["section"])
+	if sec == nil || sec.project != proj {
+		writeError(w, http.StatusBadRequest, "section: Unknown object")
+		return
+	}
+
+	if (gids["before_section"] == "") == (gids["after_section"] == "") {
+		writeError(w, http.StatusBadRequest, "Exactly one of before_section or after_section is required")
+		return
+	}
+
+	anchorGID := gids["before_section"]
+	after := false
+	if anchorGID == "" {
+		anchorGID = gids["after_section"]
+		after = true
+	}
+
+	anchor := s.findSection(anchorGID)
+	if anchor == nil || anchor.project != proj || anchor == sec {
+		writeError(w, http.StatusBadRequest, "Invalid anchor section")
+		return
+	}
+
+	s.removeSection(sec)
+
+	secs := []*section{}
+	for _, existing := range s.sections {
+		if existing == anchor && after {
+			secs = append(secs, existing, sec)
+			continue
+		}
+
+		if existing == anchor {
+			secs = append(secs, sec)
+		}
+
+		secs = append(secs, existing)
+	}
+	s.sections = secs
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: map[string]interface{}{}})
+}
+
+// Must be called with s.mu already locked
+func (s *Server) removeSection(sec *section) {
+	secs := []*section{}
+	for _, existing := range s.sections {
+		if existing != sec {
+			secs = append(secs, existing)
+		}
+	}
+	s.sections = secs
+}
+
+// Must be called with s.mu already locked
+func (s *Server) nextSection(sec *section) *section {
+	found := false
+	for _, existing := range s.sections {
+		if existing == sec {
+			found = true
+			continue
+		}
+
+		if found && existing.project == sec.project {
+			return existing
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,664 @@
+package asanatest
+
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "net/http/httptest"
+import "strconv"
+import "strings"
+import "sync"
+import "time"
+
+import "github.com/firestuff/automana/client"
+
+// Server is an in-memory stand-in for the subset of the Asana API used by
+// the client package. Seed it with the Add* methods, then point a client at
+// it with Client().
+type Server struct {
+	Token string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	nextGID  int64
+	created  time.Time
+	me       *client.User
+	requests []string
+	failures []*failure
+
+	oauth *oauthState
+
+	events    []*event
+	syncEpoch int
+	hooks     []*hook
+	stories   []*story
+
+	customFields        []*customField
+	customFieldSettings []*customFieldSetting
+
+	workspaces []*client.Workspace
+	users      []*client.User
+	projects   []*project
+	sections   []*section
+	tags       []*tag
+	teams      []*team
+	tasks      []*Task
+}
+
+// Task is the server-side view of a task, including the memberships that
+// the API only exposes through query parameters.
+type Task struct {
+	GID         string
+	Name        string
+	CreatedAt   string
+	ModifiedAt  string
+	StartOn     string
+	DueOn       string
+	DueAt       string
+	HTMLNotes   string
+	Completed   bool
+	CompletedAt string
+	Assignee    *client.User
+	Parent      string
+	Sections    []*client.Section
+	Tags        []*client.Tag
+	Followers   []*client.User
+
+	// Defaults to default_task
+	ResourceSubtype string
+	HasAttachment   bool
+	CustomFields    []*client.CustomField
+	// GIDs of tasks this one is blocked by
+	Dependencies []string
+
+	workspace *client.Workspace
+}
+
+type failure struct {
+	status     int
+	retryAfter string
+}
+
+type project struct {
+	*client.Project
+	workspace *client.Workspace
+	owner     *client.User
+	team      *client.Team
+}
+
+type section struct {
+	*client.Section
+	project *project
+}
+
+type team struct {
+	*client.Team
+	workspace *client.Workspace
+}
+
+type tag struct {
+	*client.Tag
+	workspace *client.Workspace
+}
+
+type errorDetails struct {
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Errors []*errorDetails `json:"errors"`
+}
+
+type nextPage struct {
+	Offset string `json:"offset"`
+	Path   string `json:"path"`
+	URI    string `json:"uri"`
+}
+
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+type listResponse struct {
+	Data     interface{} `json:"data"`
+	NextPage *nextPage   `json:"next_page"`
+}
+
+type dataResponse struct {
+	Data interface{} `json:"data"`
+}
+
+func NewServer() *Server {
+	s := &Server{
+		Token:   "asanatest-token",
+		nextGID: 1000,
+		created: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		oauth: &oauthState{
+			tokenLifetime: time.Hour,
+			codes:         map[string]bool{},
+			refresh:       map[string]bool{},
+		},
+	}
+
+	s.srv = httptest.NewServer(s)
+
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+func (s *Server) URL() string {
+	return s.srv.URL + "/"
+}
+
+func (s *Server) Client() *client.Client {
+	return client.NewClientWithBaseURL(s.Token, s.URL())
+}
+
+// Requests returns "METHOD path" for every request served so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.requests...)
+}
+
+// FailNext makes the next /count/ requests fail with /status/, setting
+// Retry-After if /retryAfter/ is non-empty.
+func (s *Server) FailNext(count, status int, retryAfter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.failures = append(s.failures, &failure{
+			status:     status,
+			retryAfter: retryAfter,
+		})
+	}
+}
+
+// Fixtures
+func (s *Server) AddWorkspace(name string) *client.Workspace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wrk := &client.Workspace{
+		GID:  s.gid(),
+		Name: name,
+	}
+	s.workspaces = append(s.workspaces, wrk)
+
+	return wrk
+}
+
+func (s *Server) AddUser(name, email string) *client.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := &client.User{
+		GID:   s.gid(),
+		Name:  name,
+		Email: email,
+	}
+	s.users = append(s.users, u)
+
+	if s.me == nil {
+		s.me = u
+	}
+
+	return u
+}
+
+// SetMe changes the user returned by users/me. Defaults to the first user
+// added.
+func (s *Server) SetMe(u *client.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.me = u
+}
+
+func (s *Server) AddProject(wrk *client.Workspace, name string) *client.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addProject(wrk, nil, name)
+}
+
+func (s *Server) AddTeam(wrk *client.Workspace, name string) *client.Team {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := &client.Team{
+		GID:  s.gid(),
+		Name: name,
+	}
+	s.teams = append(s.teams, &team{
+		Team:      t,
+		workspace: wrk,
+	})
+
+	return t
+}
+
+func (s *Server) AddTeamProject(wrk *client.Workspace, t *client.Team, name string) *client.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	proj := s.addProject(wrk, nil, name)
+	s.findProject(proj.GID).team = t
+
+	return proj
+}
+
+// AddUserTaskList creates the My Tasks list for u in wrk, with the given
+// sections in order.
+func (s *Server) AddUserTaskList(wrk *client.Workspace, u *client.User, sectionNames ...string) *client.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	utl := s.addProject(wrk, u, fmt.Sprintf("My Tasks in %s", wrk.Name))
+
+	for _, name := range sectionNames {
+		s.addSection(utl, name)
+	}
+
+	return utl
+}
+
+func (s *Server) AddSection(proj *client.Project, name string) *client.Section {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addSection(proj, name)
+}
+
+func (s *Server) AddTag(wrk *client.Workspace, name string) *client.Tag {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := &client.Tag{
+		GID:  s.gid(),
+		Name: name,
+	}
+	s.tags = append(s.tags, &tag{
+		Tag:       t,
+		workspace: wrk,
+	})
+
+	return t
+}
+
+// AddTask stores a copy of t in wrk, filling in GID and CreatedAt if unset,
+// and returns the stored GID.
+func (s *Server) AddTask(wrk *client.Workspace, t *Task) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *t
+	stored.workspace = wrk
+	stored.Sections = append([]*client.Section{}, t.Sections...)
+	stored.Tags = append([]*client.Tag{}, t.Tags...)
+	stored.Followers = append([]*client.User{}, t.Followers...)
+	stored.CustomFields = copyCustomFields(t.CustomFields)
+	stored.Dependencies = append([]string{}, t.Dependencies...)
+
+	if stored.ResourceSubtype == "" {
+		stored.ResourceSubtype = "default_task"
+	}
+
+	if stored.GID == "" {
+		stored.GID = s.gid()
+	}
+
+	if stored.CreatedAt == "" {
+		s.created = s.created.Add(time.Second)
+		stored.CreatedAt = s.created.Format(timeFormat)
+	}
+
+	if stored.ModifiedAt == "" {
+		stored.ModifiedAt = stored.CreatedAt
+	}
+
+	s.tasks = append(s.tasks, &stored)
+
+	return stored.GID
+}
+
+// GetTask returns a copy of the current server-side state of a task.
+func (s *Server) GetTask(gid string) *Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.findTask(gid)
+	if t == nil {
+		return nil
+	}
+
+	ret := *t
+	ret.Sections = append([]*client.Section{}, t.Sections...)
+	ret.Tags = append([]*client.Tag{}, t.Tags...)
+	ret.Followers = append([]*client.User{}, t.Followers...)
+	ret.CustomFields = copyCustomFields(t.CustomFields)
+	ret.Dependencies = append([]string{}, t.Dependencies...)
+
+	return &ret
+}
+
+// copyCustomFields copies the fields themselves, since updates modify them
+// in place
+func copyCustomFields(cfs []*client.CustomField) []*client.CustomField {
+	ret := []*client.CustomField{}
+	for _, cf := range cfs {
+		c := *cf
+		ret = append(ret, &c)
+	}
+	return ret
+}
+
+// Must be called with s.mu already locked
+func (s *Server) gid() string {
+	s.nextGID++
+	return strconv.FormatInt(s.nextGID, 10)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) addProject(wrk *client.Workspace, owner *client.User, name string) *client.Project {
+	p := &client.Project{
+		GID:  s.gid(),
+		Name: name,
+	}
+	s.projects = append(s.projects, &project{
+		Project:   p,
+		workspace: wrk,
+		owner:     owner,
+	})
+
+	return p
+}
+
+// Must be called with s.mu already locked
+func (s *Server) addSection(proj *client.Project, name string) *client.Section {
+	sec := &client.Section{
+		GID:  s.gid(),
+		Name: name,
+	}
+	s.sections = append(s.sections, &section{
+		Section: sec,
+		project: s.findProject(proj.GID),
+	})
+
+	return sec
+}
+
+// HTTP
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	w.Header().Set("X-Asana-Request-Id", fmt.Sprintf("asanatest-%d", len(s.requests)))
+
+	if strings.HasPrefix(r.URL.Path, "/-/oauth_") {
+		s.serveOAuth(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != fmt.Sprintf("Bearer %s", s.Token) {
+		writeError(w, http.StatusUnauthorized, "Not Authorized")
+		return
+	}
+
+	if len(s.failures) > 0 {
+		f := s.failures[0]
+		s.failures = s.failures[1:]
+
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+
+		writeError(w, f.status, http.StatusText(f.status))
+		return
+	}
+
+	s.route(w, r)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	for _, rt := range routes {
+		if rt.method != r.Method {
+			continue
+		}
+
+		args, ok := match(parts, rt.pattern)
+		if !ok {
+			continue
+		}
+
+		rt.handler(s, w, r, args)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s: no route", r.Method, r.URL.Path))
+}
+
+type handler func(*Server, http.ResponseWriter, *http.Request, []string)
+
+type route struct {
+	method  string
+	pattern string
+	handler handler
+}
+
+var routes []*route
+
+func init() {
+	// Assigned in init since batch refers back to routes
+	routes = []*route{
+		{"POST", "batch", (*Server).batch},
+		{"GET", "events", (*Server).getEvents},
+		{"GET", "webhooks", (*Server).getWebhooks},
+		{"POST", "webhooks", (*Server).createWebhook},
+		{"DELETE", "webhooks/*", (*Server).deleteWebhook},
+		{"GET", "workspaces", (*Server).getWorkspaces},
+		{"GET", "workspaces/*/projects", (*Server).getProjects},
+		{"GET", "workspaces/*/tags", (*Server).getTags},
+		{"GET", "workspaces/*/teams", (*Server).getTeams},
+		{"GET", "workspaces/*/users", (*Server).getUsers},
+		{"GET", "workspaces/*/custom_fields", (*Server).getCustomFields},
+		{"GET", "projects/*/custom_field_settings", (*Server).getCustomFieldSettings},
+		{"GET", "workspaces/*/tasks/search", (*Server).searchTasks},
+		{"GET", "users/me", (*Server).getMe},
+		{"GET", "users/*", (*Server).getUser},
+		{"GET", "users/*/user_task_list", (*Server).getUserTaskList},
+		{"GET", "projects/*/sections", (*Server).getSections},
+		{"POST", "projects/*/sections", (*Server).createSection},
+		{"POST", "projects/*/sections/insert", (*Server).insertSection},
+		{"PUT", "sections/*", (*Server).updateSection},
+		{"DELETE", "sections/*", (*Server).deleteSection},
+		{"GET", "sections/*/tasks", (*Server).getSectionTasks},
+		{"POST", "sections/*/addTask", (*Server).addTaskToSection},
+		{"POST", "tasks", (*Server).createTask},
+		{"GET", "tasks/*", (*Server).getTask},
+		{"PUT", "tasks/*", (*Server).updateTask},
+		{"DELETE", "tasks/*", (*Server).deleteTask},
+		{"GET", "tasks/*/subtasks", (*Server).getSubtasks},
+		{"POST", "tasks/*/duplicate", (*Server).duplicateTask},
+		{"POST", "tasks/*/setParent", (*Server).setParent},
+		{"POST", "tasks/*/addDependencies", (*Server).addDependencies},
+		{"POST", "tasks/*/removeDependencies", (*Server).removeDependencies},
+		{"GET", "tasks/*/stories", (*Server).getStories},
+		{"POST", "tasks/*/stories", (*Server).addComment},
+		{"POST", "tasks/*/addTag", (*Server).addTag},
+		{"POST", "tasks/*/removeTag", (*Server).removeTag},
+		{"POST", "tasks/*/addProject", (*Server).addTaskToProject},
+		{"POST", "tasks/*/removeProject", (*Server).removeTaskFromProject},
+		{"POST", "tasks/*/addFollowers", (*Server).addFollowers},
+		{"POST", "tasks/*/removeFollowers", (*Server).removeFollowers},
+	}
+}
+
+func match(parts []string, pattern string) ([]string, bool) {
+	pats := strings.Split(pattern, "/")
+	if len(pats) != len(parts) {
+		return nil, false
+	}
+
+	args := []string{}
+
+	for i, pat := range pats {
+		if pat == "*" {
+			args = append(args, parts[i])
+			continue
+		}
+
+		if pat != parts[i] {
+			return nil, false
+		}
+	}
+
+	return args, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, &errorResponse{
+		Errors: []*errorDetails{
+			{Message: msg},
+		},
+	})
+}
+
+// writePage slices items according to limit/offset and writes a list
+// response with next_page set if there are more.
+func writePage(w http.ResponseWriter, r *http.Request, n int, slice func(start, end int) interface{}) {
+	q := r.URL.Query()
+
+	limit := n
+	if q.Get("limit") != "" {
+		l, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || l < 1 || l > 100 {
+			writeError(w, http.StatusBadRequest, "limit: Not a valid limit")
+			return
+		}
+		limit = l
+	}
+
+	start := 0
+	if q.Get("offset") != "" {
+		o, err := strconv.Atoi(q.Get("offset"))
+		if err != nil || o < 0 {
+			writeError(w, http.StatusBadRequest, "offset: Not a valid offset")
+			return
+		}
+		start = o
+	}
+
+	if start > n {
+		start = n
+	}
+
+	end := start + limit
+	if end > n {
+		end = n
+	}
+
+	resp := &listResponse{
+		Data: slice(start, end),
+	}
+
+	if end < n {
+		offset := strconv.Itoa(end)
+		q.Set("offset", offset)
+		resp.NextPage = &nextPage{
+			Offset: offset,
+			Path:   fmt.Sprintf("%s?%s", r.URL.Path, q.Encode()),
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Must be called with s.mu already locked
+func (s *Server) findWorkspace(gid string) *client.Workspace {
+	for _, wrk := range s.workspaces {
+		if wrk.GID == gid {
+			return wrk
+		}
+	}
+
+	return nil
+}
+
+// findUser accepts anything Asana accepts as a user identifier: a GID, an
+// email address or "me"
+//
+// Must be called with s.mu already locked
+func (s *Server) findUser(gid string) *client.User {
+	if gid == "me" {
+		return s.me
+	}
+
+	for _, u := range s.users {
+		if u.GID == gid || u.Email == gid {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) findProject(gid string) *project {
+	for _, p := range s.projects {
+		if p.GID == gid {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) findSection(gid string) *section {
+	for _, sec := range s.sections {
+		if sec.GID == gid {
+			return sec
+		}
+	}
+
+	return nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) findTag(gid string) *tag {
+	for _, t := range s.tags {
+		if t.GID == gid {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// Must be called with s.mu already locked
+func (s *Server) findTask(gid string) *Task {
+	for _, t := range s.tasks {
+		if t.GID == gid {
+			return t
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package asanatest
+
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "strings"
+import "time"
+
+import "golang.org/x/net/html"
+
+import "github.com/firestuff/automana/client"
+
+type story struct {
+	*client.Story
+	task string
+}
+
+// AddStory appends st to the history of the task with GID taskGID, filling
+// in GID, CreatedBy and CreatedAt if unset. Use it to seed history that
+// predates the test.
+func (s *Server) AddStory(taskGID string, st *client.Story) *client.Story {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *st
+
+	if stored.GID == "" {
+		stored.GID = s.gid()
+	}
+
+	if stored.CreatedBy == nil {
+		stored.CreatedBy = s.me
+	}
+
+	if stored.CreatedAt == "" {
+		stored.CreatedAt = time.Now().UTC().Format(timeFormat)
+	}
+
+	if stored.Type == "" {
+		stored.Type = "system"
+		if stored.ResourceSubtype == "comment_added" {
+			stored.Type = "comment"
+		}
+	}
+
+	s.stories = append(s.stories, &story{
+		Story: &stored,
+		task:  taskGID,
+	})
+
+	return &stored
+}
+
+// GetStories returns copies of the history of the task with GID taskGID,
+// oldest first
+func (s *Server) GetStories(taskGID string) []*client.Story {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := []*client.Story{}
+	for _, st := range s.stories {
+		if st.task == taskGID {
+			copied := *st.Story
+			ret = append(ret, &copied)
+		}
+	}
+
+	return ret
+}
+
+func (s *Server) getStories(w http.ResponseWriter, r *http.Request, args []string) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	stories := []*client.Story{}
+	for _, st := range s.stories {
+		if st.task == t.GID {
+			stories = append(stories, st.Story)
+		}
+	}
+
+	writePage(w, r, len(stories), func(start, end int) interface{} {
+		return stories[start:end]
+	})
+}
+
+func (s *Server) addComment(w http.ResponseWriter, r *http.Request, args []string) {
+	t, body := s.taskAction(w, r, args)
+	if t == nil {
+		return
+	}
+
+	htmlText := ""
+	err := json.Unmarshal(body.Data["html_text"], &htmlText)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "html_text: Missing input")
+		return
+	}
+
+	text, err := plainText(htmlText)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("html_text: %s", err))
+		return
+	}
+
+	st := s.addStory(t, "comment_added", text)
+	st.Type = "comment"
+	st.HTMLText = htmlText
+
+	writeJSON(w, http.StatusCreated, &dataResponse{Data: st})
+}
+
+// Must be called with s.mu already locked
+func (s *Server) addStory(t *Task, subtype, text string) *client.Story {
+	st := &client.Story{
+		GID:             s.gid(),
+		Type:            "system",
+		ResourceSubtype: subtype,
+		Text:            text,
+		CreatedBy:       s.me,
+		CreatedAt:       time.Now().UTC().Format(timeFormat),
+	}
+
+	s.stories = append(s.stories, &story{
+		Story: st,
+		task:  t.GID,
+	})
+
+	return st
+}
+
+// Must be called with s.mu already locked
+func (s *Server) addChangeStory(t *Task, field string) {
+	switch field {
+	case "name":
+		s.addStory(t, "name_changed", fmt.Sprintf("changed the name to %s", t.Name))
+
+	case "html_notes":
+		s.addStory(t, "notes_changed", "changed the description")
+
+	case "start_on":
+		s.addStory(t, "start_date_changed", "changed the start date")
+
+	case "due_on", "due_at":
+		s.addStory(t, "due_date_changed", "changed the due date")
+
+	case "completed":
+		if t.Completed {
+			s.addStory(t, "marked_complete", "marked this task complete")
+		} else {
+			s.addStory(t, "marked_incomplete", "marked incomplete")
+		}
+
+	case "assignee":
+		if t.Assignee == nil {
+			s.addStory(t, "unassigned", "unassigned")
+		} else {
+			st := s.addStory(t, "assigned", fmt.Sprintf("assigned to %s", t.Assignee.Name))
+			st.Assignee = t.Assignee
+		}
+	}
+}
+
+func plainText(htmlText string) (string, error) {
+	root, err := html.Parse(strings.NewReader(htmlText))
+	if err != nil {
+		return "", err
+	}
+
+	buf := &strings.Builder{}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	return buf.String(), nil
+}
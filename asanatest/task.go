@@ -0,0 +1,434 @@
+package asanatest
+
+import "encoding/json"
+import "fmt"
+import "net/http"
+import "strings"
+import "time"
+
+import "github.com/firestuff/automana/client"
+
+func (s *Server) getTask(w http.ResponseWriter, r *http.Request, args []string) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: s.renderTask(t)})
+}
+
+func (s *Server) getSubtasks(w http.ResponseWriter, r *http.Request, args []string) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	tasks := s.subtasks(t)
+
+	writePage(w, r, len(tasks), func(start, end int) interface{} {
+		return s.renderTasks(tasks[start:end])
+	})
+}
+
+func (s *Server) createTask(w http.ResponseWriter, r *http.Request, _ []string) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	wrkGID := ""
+	_ = json.Unmarshal(body.Data["workspace"], &wrkGID)
+	wrk := s.findWorkspace(wrkGID)
+	if wrk == nil {
+		writeError(w, http.StatusBadRequest, "workspace: Missing input")
+		return
+	}
+
+	s.created = s.created.Add(time.Second)
+	t := &Task{
+		GID:             s.gid(),
+		CreatedAt:       s.created.Format(timeFormat),
+		ResourceSubtype: "default_task",
+		workspace:       wrk,
+	}
+
+	fields := map[string]interface{}{
+		"name":             &t.Name,
+		"resource_subtype": &t.ResourceSubtype,
+		"start_on":         &t.StartOn,
+		"due_on":           &t.DueOn,
+		"due_at":           &t.DueAt,
+		"html_notes":       &t.HTMLNotes,
+		"completed":        &t.Completed,
+		"parent":           &t.Parent,
+	}
+
+	refs := map[string]*[]string{}
+	for _, key := range []string{"assignee", "assignee_section", "projects", "tags", "followers"} {
+		refs[key] = &[]string{}
+	}
+
+	for key, raw := range body.Data {
+		if key == "workspace" {
+			continue
+		}
+
+		if ref, found := refs[key]; found {
+			err = unmarshalGIDs(raw, ref)
+		} else if field, found := fields[key]; found {
+			err = json.Unmarshal(raw, field)
+		} else {
+			err = fmt.Errorf("Unsupported field")
+		}
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: %s", key, err))
+			return
+		}
+	}
+
+	if t.Parent != "" && s.findTask(t.Parent) == nil {
+		writeError(w, http.StatusBadRequest, "parent: Unknown object")
+		return
+	}
+
+	for _, gid := range *refs["assignee"] {
+		t.Assignee = s.findUser(gid)
+		if t.Assignee == nil {
+			writeError(w, http.StatusBadRequest, "assignee: Unknown object")
+			return
+		}
+	}
+
+	for _, gid := range *refs["tags"] {
+		tag := s.findTag(gid)
+		if tag == nil {
+			writeError(w, http.StatusBadRequest, "tags: Unknown object")
+			return
+		}
+		t.Tags = append(t.Tags, tag.Tag)
+	}
+
+	for _, gid := range *refs["followers"] {
+		u := s.findUser(gid)
+		if u == nil {
+			writeError(w, http.StatusBadRequest, "followers: Unknown object")
+			return
+		}
+		t.Followers = append(t.Followers, u)
+	}
+
+	secs := []*section{}
+
+	for _, gid := range *refs["projects"] {
+		proj := s.findProject(gid)
+		if proj == nil {
+			writeError(w, http.StatusBadRequest, "projects: Unknown object")
+			return
+		}
+
+		// New tasks land in the first section of each project
+		sec := s.firstSection(proj)
+		if sec != nil {
+			secs = append(secs, sec)
+		}
+	}
+
+	for _, gid := range *refs["assignee_section"] {
+		sec := s.findSection(gid)
+		if sec == nil {
+			writeError(w, http.StatusBadRequest, "assignee_section: Unknown object")
+			return
+		}
+		secs = append(secs, sec)
+	}
+
+	t.ModifiedAt = t.CreatedAt
+	s.tasks = append(s.tasks, t)
+	s.touch(t)
+
+	for _, sec := range secs {
+		s.moveToSection(t, sec)
+	}
+
+	writeJSON(w, http.StatusCreated, &dataResponse{Data: s.renderTask(t)})
+}
+
+func (s *Server) deleteTask(w http.ResponseWriter, r *http.Request, args []string) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	tasks := []*Task{}
+	for _, other := range s.tasks {
+		if other != t {
+			tasks = append(tasks, other)
+		}
+	}
+	s.tasks = tasks
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: map[string]interface{}{}})
+}
+
+func (s *Server) duplicateTask(w http.ResponseWriter, r *http.Request, args []string) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := ""
+	err = json.Unmarshal(body.Data["name"], &name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "name: Missing input")
+		return
+	}
+
+	include := ""
+	if raw, found := body.Data["include"]; found {
+		err = json.Unmarshal(raw, &include)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("include: %s", err))
+			return
+		}
+	}
+
+	dup := s.duplicate(t, name, t.Parent, include)
+
+	writeJSON(w, http.StatusCreated, &dataResponse{Data: map[string]interface{}{
+		"gid":           s.gid(),
+		"resource_type": "job",
+		"status":        "succeeded",
+		"new_task": map[string]string{
+			"gid":  dup.GID,
+			"name": dup.Name,
+		},
+	}})
+}
+
+func (s *Server) setParent(w http.ResponseWriter, r *http.Request, args []string) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	raw, found := body.Data["parent"]
+	if !found {
+		writeError(w, http.StatusBadRequest, "parent: Missing input")
+		return
+	}
+
+	parent := ""
+	err = unmarshalNullableGID(raw, &parent)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("parent: %s", err))
+		return
+	}
+
+	if parent != "" {
+		for p := s.findTask(parent); p != nil; p = s.findTask(p.Parent) {
+			if p == t {
+				writeError(w, http.StatusBadRequest, "parent: Cannot create a cycle")
+				return
+			}
+		}
+
+		if s.findTask(parent) == nil {
+			writeError(w, http.StatusBadRequest, "parent: Unknown object")
+			return
+		}
+	}
+
+	t.Parent = parent
+	s.touch(t)
+	s.emitTaskChanged(t, "parent")
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: s.renderTask(t)})
+}
+
+func (s *Server) addDependencies(w http.ResponseWriter, r *http.Request, args []string) {
+	s.changeDependencies(w, r, args, func(t *Task, gid string) {
+		for _, existing := range t.Dependencies {
+			if existing == gid {
+				return
+			}
+		}
+		t.Dependencies = append(t.Dependencies, gid)
+	})
+}
+
+func (s *Server) removeDependencies(w http.ResponseWriter, r *http.Request, args []string) {
+	s.changeDependencies(w, r, args, func(t *Task, gid string) {
+		deps := []string{}
+		for _, existing := range t.Dependencies {
+			if existing != gid {
+				deps = append(deps, existing)
+			}
+		}
+		t.Dependencies = deps
+	})
+}
+
+// Must be called with s.mu already locked
+func (s *Server) changeDependencies(w http.ResponseWriter, r *http.Request, args []string, change func(*Task, string)) {
+	t := s.findTask(args[0])
+	if t == nil {
+		writeError(w, http.StatusNotFound, "task: Unknown object")
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	gids := []string{}
+	err = json.Unmarshal(body.Data["dependencies"], &gids)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "dependencies: Missing input")
+		return
+	}
+
+	for _, gid := range gids {
+		if s.findTask(gid) == nil || gid == t.GID {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("dependencies: Invalid task %s", gid))
+			return
+		}
+	}
+
+	for _, gid := range gids {
+		change(t, gid)
+	}
+
+	s.touch(t)
+	s.emitTaskChanged(t, "dependencies")
+
+	writeJSON(w, http.StatusOK, &dataResponse{Data: map[string]interface{}{}})
+}
+
+// duplicate copies t and whatever include lists, recursing into subtasks
+//
+// Must be called with s.mu already locked
+func (s *Server) duplicate(t *Task, name, parent, include string) *Task {
+	inc := map[string]bool{}
+	for _, opt := range strings.Split(include, ",") {
+		inc[strings.TrimSpace(opt)] = true
+	}
+
+	s.created = s.created.Add(time.Second)
+	dup := &Task{
+		GID:             s.gid(),
+		Name:            name,
+		CreatedAt:       s.created.Format(timeFormat),
+		ResourceSubtype: t.ResourceSubtype,
+		Parent:          parent,
+		workspace:       t.workspace,
+	}
+	dup.ModifiedAt = dup.CreatedAt
+
+	if inc["notes"] {
+		dup.HTMLNotes = t.HTMLNotes
+	}
+
+	if inc["assignee"] {
+		dup.Assignee = t.Assignee
+	}
+
+	if inc["dates"] {
+		dup.StartOn = t.StartOn
+		dup.DueOn = t.DueOn
+		dup.DueAt = t.DueAt
+	}
+
+	if inc["tags"] {
+		dup.Tags = append([]*client.Tag{}, t.Tags...)
+	}
+
+	if inc["followers"] {
+		dup.Followers = append([]*client.User{}, t.Followers...)
+	}
+
+	if inc["projects"] {
+		dup.Sections = append([]*client.Section{}, t.Sections...)
+	}
+
+	s.tasks = append(s.tasks, dup)
+
+	if inc["subtasks"] {
+		for _, sub := range s.subtasks(t) {
+			s.duplicate(sub, sub.Name, dup.GID, include)
+		}
+	}
+
+	return dup
+}
+
+// Must be called with s.mu already locked
+func (s *Server) subtasks(t *Task) []*Task {
+	ret := []*Task{}
+	for _, other := range s.tasks {
+		if other.Parent == t.GID {
+			ret = append(ret, other)
+		}
+	}
+
+	return ret
+}
+
+// Must be called with s.mu already locked
+func (s *Server) firstSection(proj *project) *section {
+	for _, sec := range s.sections {
+		if sec.project == proj {
+			return sec
+		}
+	}
+
+	return nil
+}
+
+// unmarshalGIDs accepts a single GID or a list of them
+func unmarshalGIDs(raw json.RawMessage, gids *[]string) error {
+	gid := ""
+	if unmarshalNullableGID(raw, &gid) == nil {
+		if gid != "" {
+			*gids = []string{gid}
+		}
+		return nil
+	}
+
+	return json.Unmarshal(raw, gids)
+}
+
+func unmarshalNullableGID(raw json.RawMessage, gid *string) error {
+	var s *string
+
+	err := json.Unmarshal(raw, &s)
+	if err != nil {
+		return err
+	}
+
+	if s != nil {
+		*gid = *s
+	}
+
+	return nil
+}
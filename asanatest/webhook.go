@@ -0,0 +1,139 @@
+package asanatest
+
+import "bytes"
+import "crypto/rand"
+import "encoding/hex"
+import "encoding/json"
+import "net/http"
+
+import "github.com/firestuff/automana/webhook"
+
+type hook struct {
+	gid      string
+	resource string
+	target   string
+	secret   []byte
+}
+
+type hookDelivery struct {
+	Events []map[string]interface{} `json:"events"`
+}
+
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request, _ []string) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resource, target := "", ""
+	_ = json.Unmarshal(body.Data["resource"], &resource)
+	_ = json.Unmarshal(body.Data["target"], &target)
+
+	if s.findProject(resource) == nil && s.findTask(resource) == nil {
+		writeError(w, http.StatusNotFound, "resource: Unknown object")
+		return
+	}
+
+	secret := make([]byte, 16)
+	_, err = rand.Read(secret)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h := &hook{
+		gid:      s.gid(),
+		resource: resource,
+		target:   target,
+		secret:   []byte(hex.EncodeToString(secret)),
+	}
+
+	// Asana completes the handshake before responding to the create
+	req, err := http.NewRequest("POST", target, nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.Header.Set("X-Hook-Secret", string(h.secret))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Unable to complete handshake")
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 || resp.Header.Get("X-Hook-Secret") != string(h.secret) {
+		writeError(w, http.StatusBadRequest, "Unable to complete handshake")
+		return
+	}
+
+	s.hooks = append(s.hooks, h)
+
+	writeJSON(w, http.StatusCreated, &dataResponse{Data: renderHook(h)})
+}
+
+func (s *Server) getWebhooks(w http.ResponseWriter, r *http.Request, _ []string) {
+	hooks := []map[string]interface{}{}
+	for _, h := range s.hooks {
+		hooks = append(hooks, renderHook(h))
+	}
+
+	writePage(w, r, len(hooks), func(start, end int) interface{} {
+		return hooks[start:end]
+	})
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request, args []string) {
+	for i, h := range s.hooks {
+		if h.gid == args[0] {
+			s.hooks = append(s.hooks[:i], s.hooks[i+1:]...)
+			writeJSON(w, http.StatusOK, &dataResponse{Data: map[string]interface{}{}})
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "webhook: Unknown object")
+}
+
+// Must be called with s.mu already locked
+func (s *Server) deliver(ev *event) {
+	for _, h := range s.hooks {
+		if h.resource != ev.resource {
+			continue
+		}
+
+		body, err := json.Marshal(&hookDelivery{
+			Events: []map[string]interface{}{ev.data},
+		})
+		if err != nil {
+			continue
+		}
+
+		req, err := http.NewRequest("POST", h.target, bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("X-Hook-Signature", webhook.Sign(h.secret, body))
+
+		// Delivered asynchronously, like the real thing
+		go func() {
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+}
+
+func renderHook(h *hook) map[string]interface{} {
+	return map[string]interface{}{
+		"gid":    h.gid,
+		"active": true,
+		"target": h.target,
+		"resource": map[string]string{
+			"gid": h.resource,
+		},
+	}
+}
@@ -0,0 +1,316 @@
+package client
+
+import "context"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "net/http"
+import "strings"
+
+// Asana's limit on actions per batch request
+const batchSize = 10
+
+// Fewer actions than this are sent as separate requests: a batch saves
+// little, and separate requests keep their order
+const minBatchChunk = 3
+
+// Batch collects writes to submit together through the /batch endpoint
+type Batch struct {
+	wc      *WorkspaceClient
+	actions []*batchAction
+}
+
+// BatchResult is the outcome of one action, in the order it was added
+type BatchResult struct {
+	StatusCode int
+	Body       json.RawMessage
+	Err        error
+}
+
+type batchAction struct {
+	RelativePath string      `json:"relative_path"`
+	Method       string      `json:"method"`
+	Data         interface{} `json:"data,omitempty"`
+
+	// Same recovery as the equivalent WorkspaceClient method
+	onError func(error) `json:"-"`
+}
+
+type batchRequestData struct {
+	Actions []*batchAction `json:"actions"`
+}
+
+type batchRequest struct {
+	Data *batchRequestData `json:"data"`
+}
+
+type batchActionResult struct {
+	StatusCode int             `json:"status_code"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchResponse struct {
+	Data []*batchActionResult `json:"data"`
+}
+
+type rawResponse struct {
+	Data json.RawMessage `json:"data"`
+}
+
+func (wc *WorkspaceClient) Batch() *Batch {
+	return &Batch{
+		wc: wc,
+	}
+}
+
+func (b *Batch) AddTaskToSection(task *Task, section *Section) *Batch {
+	return b.addTaskToSection(section, &sectionAddTaskData{
+		Task: task.GID,
+	})
+}
+
+// AddTaskToSectionBefore is positional, so it shouldn't share a batch with
+// other moves in the same section: batch actions aren't ordered
+func (b *Batch) AddTaskToSectionBefore(task *Task, section *Section, before *Task) *Batch {
+	return b.addTaskToSection(section, &sectionAddTaskData{
+		Task:         task.GID,
+		InsertBefore: before.GID,
+	})
+}
+
+// AddTaskToSectionAfter has the same caveat as AddTaskToSectionBefore
+func (b *Batch) AddTaskToSectionAfter(task *Task, section *Section, after *Task) *Batch {
+	return b.addTaskToSection(section, &sectionAddTaskData{
+		Task:        task.GID,
+		InsertAfter: after.GID,
+	})
+}
+
+func (b *Batch) addTaskToSection(section *Section, data *sectionAddTaskData) *Batch {
+	b.add("POST", fmt.Sprintf("sections/%s/addTask", section.GID), data)
+	b.onError(b.wc.sectionNotFound)
+	return b
+}
+
+func (b *Batch) UpdateTask(task *Task, patch *TaskPatch) *Batch {
+	return b.add("PUT", fmt.Sprintf("tasks/%s", task.GID), patch.data())
+}
+
+func (b *Batch) AddTag(task *Task, tag *Tag) *Batch {
+	b.add("POST", fmt.Sprintf("tasks/%s/addTag", task.GID), &taskTagData{
+		Tag: tag.GID,
+	})
+	b.onError(b.wc.tagNotFound)
+	return b
+}
+
+func (b *Batch) RemoveTag(task *Task, tag *Tag) *Batch {
+	b.add("POST", fmt.Sprintf("tasks/%s/removeTag", task.GID), &taskTagData{
+		Tag: tag.GID,
+	})
+	b.onError(b.wc.tagNotFound)
+	return b
+}
+
+func (b *Batch) AddProject(task *Task, project *Project) *Batch {
+	b.add("POST", fmt.Sprintf("tasks/%s/addProject", task.GID), &taskProjectData{
+		Project: project.GID,
+	})
+	b.onError(b.wc.projectNotFound)
+	return b
+}
+
+func (b *Batch) RemoveProject(task *Task, project *Project) *Batch {
+	b.add("POST", fmt.Sprintf("tasks/%s/removeProject", task.GID), &taskProjectData{
+		Project: project.GID,
+	})
+	b.onError(b.wc.projectNotFound)
+	return b
+}
+
+func (b *Batch) AddFollowers(task *Task, users []*User) *Batch {
+	return b.add("POST", fmt.Sprintf("tasks/%s/addFollowers", task.GID), newTaskFollowersData(users))
+}
+
+func (b *Batch) RemoveFollowers(task *Task, users []*User) *Batch {
+	return b.add("POST", fmt.Sprintf("tasks/%s/removeFollowers", task.GID), newTaskFollowersData(users))
+}
+
+func (b *Batch) AddComment(task *Task, htmlText string) *Batch {
+	return b.add("POST", fmt.Sprintf("tasks/%s/stories", task.GID), &storyCreateData{
+		HTMLText: htmlText,
+	})
+}
+
+func (b *Batch) Len() int {
+	return len(b.actions)
+}
+
+// Ready returns whether there are enough actions to fill a batch request
+func (b *Batch) Ready() bool {
+	return len(b.actions) >= batchSize
+}
+
+// Execute submits all collected actions and returns one result per action.
+// Chunks too small to be worth a batch request are sent as ordinary
+// requests. The returned error is only set if a whole chunk failed;
+// per-action failures are reported in BatchResult.Err. The batch is empty
+// afterwards either way.
+func (b *Batch) Execute(ctx context.Context) ([]*BatchResult, error) {
+	actions := b.actions
+	b.actions = nil
+
+	results := []*BatchResult{}
+
+	for start := 0; start < len(actions); start += batchSize {
+		end := start + batchSize
+		if end > len(actions) {
+			end = len(actions)
+		}
+
+		chunk := actions[start:end]
+
+		var chunkResults []*BatchResult
+		var err error
+
+		if len(chunk) < minBatchChunk {
+			chunkResults, err = b.executeSingles(ctx, chunk)
+		} else {
+			chunkResults, err = b.executeChunk(ctx, chunk)
+		}
+
+		for i, result := range chunkResults {
+			if result.Err != nil && chunk[i].onError != nil {
+				chunk[i].onError(result.Err)
+			}
+		}
+
+		if err != nil {
+			return append(results, chunkResults...), err
+		}
+
+		results = append(results, chunkResults...)
+	}
+
+	return results, nil
+}
+
+// onError sets the recovery for the last action added
+func (b *Batch) onError(fn func(error)) {
+	b.actions[len(b.actions)-1].onError = fn
+}
+
+func (b *Batch) add(method, path string, data interface{}) *Batch {
+	b.actions = append(b.actions, &batchAction{
+		RelativePath: path,
+		Method:       method,
+		Data:         data,
+	})
+
+	return b
+}
+
+func (b *Batch) executeSingles(ctx context.Context, chunk []*batchAction) ([]*BatchResult, error) {
+	results := []*BatchResult{}
+
+	for _, action := range chunk {
+		result, err := b.executeSingle(ctx, action)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (b *Batch) executeSingle(ctx context.Context, action *batchAction) (*BatchResult, error) {
+	req := &struct {
+		Data interface{} `json:"data"`
+	}{
+		Data: action.Data,
+	}
+
+	resp := &rawResponse{}
+	err := b.wc.client.doWithBody(ctx, action.Method, action.RelativePath, req, resp)
+
+	result := &BatchResult{
+		StatusCode: http.StatusOK,
+		Body:       resp.Data,
+		Err:        err,
+	}
+
+	apiErr := &APIError{}
+	if errors.As(err, &apiErr) {
+		result.StatusCode = apiErr.StatusCode
+	} else if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (b *Batch) executeChunk(ctx context.Context, chunk []*batchAction) ([]*BatchResult, error) {
+	actions := []*batchAction{}
+	for _, action := range chunk {
+		actions = append(actions, &batchAction{
+			RelativePath: fmt.Sprintf("/%s", action.RelativePath),
+			Method:       strings.ToLower(action.Method),
+			Data:         action.Data,
+		})
+	}
+
+	req := &batchRequest{
+		Data: &batchRequestData{
+			Actions: actions,
+		},
+	}
+
+	// Asana counts each action against the rate limit; the request itself
+	// pays for one
+	rateLimit := b.wc.client.getLimits().general()
+
+	for i := 1; i < len(chunk); i++ {
+		err := rateLimit.Acquire(ctx, CostWrite)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &batchResponse{}
+	err := b.wc.client.post(ctx, "batch", req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Data) != len(chunk) {
+		return nil, fmt.Errorf("batch returned %d results for %d actions", len(resp.Data), len(chunk))
+	}
+
+	results := []*BatchResult{}
+
+	for i, actionResult := range resp.Data {
+		result := &BatchResult{
+			StatusCode: actionResult.StatusCode,
+		}
+
+		if actionResult.StatusCode >= 200 && actionResult.StatusCode < 300 {
+			body := &rawResponse{}
+			if len(actionResult.Body) > 0 {
+				err = json.Unmarshal(actionResult.Body, body)
+				if err != nil {
+					return nil, err
+				}
+			}
+			result.Body = body.Data
+		} else {
+			status := fmt.Sprintf("%d %s", actionResult.StatusCode, http.StatusText(actionResult.StatusCode))
+			result.Err = newAPIErrorFromBody(chunk[i].Method, chunk[i].RelativePath, actionResult.StatusCode, status, actionResult.Body)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,180 @@
+package client_test
+
+import "context"
+import "errors"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func countRequests(s *asanatest.Server, req string) int {
+	count := 0
+
+	for _, r := range s.Requests() {
+		if r == req {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestBatchChunking(t *testing.T) {
+	tests := []struct {
+		actions int
+		batches int
+	}{
+		{1, 0},
+		{2, 0},
+		{3, 1},
+		{10, 1},
+		{12, 1},
+		{13, 2},
+	}
+
+	for _, test := range tests {
+		s := asanatest.NewServer()
+
+		wrk := s.AddWorkspace("Work")
+		proj := s.AddProject(wrk, "Project")
+		sec := s.AddSection(proj, "Section")
+
+		ctx := context.Background()
+
+		c := s.Client()
+		// Only chunking is under test
+		c.SetRateLimit(client.NewRateLimit(1000, 1000))
+
+		wc, err := c.InWorkspace(ctx, "Work")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		batch := wc.Batch()
+		for i := 0; i < test.actions; i++ {
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+			batch.AddTaskToSection(&client.Task{GID: gid}, sec)
+		}
+
+		results, err := batch.Execute(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != test.actions {
+			t.Errorf("%d actions: got %d results", test.actions, len(results))
+		}
+
+		for _, result := range results {
+			if result.Err != nil {
+				t.Errorf("%d actions: %s", test.actions, result.Err)
+			}
+		}
+
+		batches := countRequests(s, "POST /batch")
+		if batches != test.batches {
+			t.Errorf("%d actions: got %d batch requests, want %d", test.actions, batches, test.batches)
+		}
+
+		s.Close()
+	}
+}
+
+func TestBatchStaleSection(t *testing.T) {
+	for _, actions := range []int{1, 3} {
+		s := asanatest.NewServer()
+
+		wrk := s.AddWorkspace("Work")
+		proj := s.AddProject(wrk, "Project")
+		s.AddSection(proj, "First")
+		stale := s.AddSection(proj, "Stale")
+
+		ctx := context.Background()
+
+		c := s.Client()
+		wc, err := c.InWorkspace(ctx, "Work")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Cache the section list, then delete behind the cache's back
+		_, err = wc.GetSectionByName(ctx, proj, "Stale")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		other, err := s.Client().InWorkspace(ctx, "Work")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = other.DeleteSection(ctx, stale)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		batch := wc.Batch()
+		for i := 0; i < actions; i++ {
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+			batch.AddTaskToSection(&client.Task{GID: gid}, stale)
+		}
+
+		results, err := batch.Execute(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !errors.Is(results[0].Err, client.ErrNotFound) {
+			t.Errorf("%d actions: got %v, want not found", actions, results[0].Err)
+		}
+
+		_, err = wc.GetSectionByName(ctx, proj, "Stale")
+		if err == nil {
+			t.Errorf("%d actions: stale section still cached", actions)
+		}
+
+		s.Close()
+	}
+}
+
+func TestBatchClearedOnFailure(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	wrk := s.AddWorkspace("Work")
+	proj := s.AddProject(wrk, "Project")
+	sec := s.AddSection(proj, "Section")
+
+	ctx := context.Background()
+
+	wc, err := s.Client().InWorkspace(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := wc.Batch()
+	for i := 0; i < 3; i++ {
+		gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+		batch.AddTaskToSection(&client.Task{GID: gid}, sec)
+	}
+
+	s.FailNext(1, 500, "")
+
+	_, err = batch.Execute(ctx)
+	if !errors.Is(err, client.ErrServer) {
+		t.Fatalf("got %v, want server error", err)
+	}
+
+	if batch.Len() != 0 {
+		t.Errorf("%d actions left after failure", batch.Len())
+	}
+
+	results, err := batch.Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 0 {
+		t.Errorf("failed actions resent: %d results", len(results))
+	}
+}
@@ -0,0 +1,157 @@
+package client
+
+import "context"
+import "encoding/json"
+import "errors"
+import "reflect"
+import "strings"
+import "sync"
+import "time"
+
+// CacheTTL sets how long each kind of metadata is reused before being
+// fetched again. Zero disables caching for that kind.
+type CacheTTL struct {
+	Workspaces    time.Duration
+	Users         time.Duration
+	UserTaskLists time.Duration
+	Projects      time.Duration
+	Sections      time.Duration
+	Tags          time.Duration
+	Teams         time.Duration
+	CustomFields  time.Duration
+}
+
+type cache struct {
+	mu      sync.Mutex
+	ttl     *CacheTTL
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func NewDefaultCacheTTL() *CacheTTL {
+	return &CacheTTL{
+		Workspaces:    1 * time.Hour,
+		Users:         1 * time.Hour,
+		UserTaskLists: 1 * time.Hour,
+		Projects:      5 * time.Minute,
+		Sections:      5 * time.Minute,
+		Tags:          5 * time.Minute,
+		Teams:         1 * time.Hour,
+		CustomFields:  5 * time.Minute,
+	}
+}
+
+func NewNoCacheTTL() *CacheTTL {
+	return &CacheTTL{}
+}
+
+func newCache(ttl *CacheTTL) *cache {
+	c := &cache{}
+	c.reset(ttl)
+	return c
+}
+
+// reset replaces the TTLs and discards all entries
+func (c *cache) reset(ttl *CacheTTL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttlCopy := *ttl
+	c.ttl = &ttlCopy
+	c.entries = map[string]*cacheEntry{}
+}
+
+func (c *cache) ttls() *CacheTTL {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ttl
+}
+
+// getOrFetch returns the cached value for key if present and fresh,
+// otherwise calls fetch and caches the result for ttl. Requests that opt
+// into or out of API changes may get different answers, so bypass the
+// cache. Callers get their own copy of cached values, which
+// they may modify.
+func (c *cache) getOrFetch(ctx context.Context, key string, ttl time.Duration, fetch func() (interface{}, error)) (interface{}, error) {
+	if changesResponse(ctx) {
+		ttl = 0
+	}
+
+	if ttl > 0 {
+		c.mu.Lock()
+		entry, found := c.entries[key]
+		c.mu.Unlock()
+
+		if found && time.Now().Before(entry.expires) {
+			return copyValue(entry.value)
+		}
+	}
+
+	value, err := fetch()
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.invalidate(key)
+		}
+		return nil, err
+	}
+
+	if ttl > 0 {
+		c.mu.Lock()
+		c.entries[key] = &cacheEntry{
+			value:   value,
+			expires: time.Now().Add(ttl),
+		}
+		c.mu.Unlock()
+
+		return copyValue(value)
+	}
+
+	return value, nil
+}
+
+// copyValue deep copies value via JSON, which all cached types round-trip
+func copyValue(value interface{}) (interface{}, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := reflect.New(reflect.TypeOf(value))
+
+	err = json.Unmarshal(js, ret.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	return ret.Elem().Interface(), nil
+}
+
+func (c *cache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+func (c *cache) invalidatePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *cache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]*cacheEntry{}
+}
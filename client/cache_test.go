@@ -0,0 +1,88 @@
+package client_test
+
+import "context"
+import "sync"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestCacheReturnsCopies(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	wrk := s.AddWorkspace("Work")
+	proj := s.AddProject(wrk, "Project")
+	s.AddSection(proj, "Section")
+
+	ctx := context.Background()
+
+	c := s.Client()
+
+	wc, err := c.InWorkspace(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		secs, err := wc.GetSections(ctx, proj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(secs) != 1 || secs[0].Name != "Section" {
+			t.Fatalf("fetch %d: got %v", i, secs)
+		}
+
+		// Must not leak into the cache
+		secs[0].Name = "Changed"
+	}
+
+	wrks, err := c.GetWorkspaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrks[0].Name = "Changed"
+
+	wrk2, err := c.GetWorkspaceByName(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wrk2.GID != wrk.GID {
+		t.Errorf("got %s, want %s", wrk2, wrk)
+	}
+}
+
+func TestSetCacheTTLDuringRequests(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	s.AddWorkspace("Work")
+
+	c := s.Client()
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := c.GetWorkspaces(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			c.SetCacheTTL(client.NewDefaultCacheTTL())
+		}()
+	}
+
+	wg.Wait()
+}
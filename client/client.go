@@ -1,24 +1,39 @@
 package client
 
 import "bytes"
+import "context"
 import "encoding/json"
 import "fmt"
+import "io"
 import "io/ioutil"
 import "net/http"
 import "net/url"
 import "os"
+import "sync"
+import "time"
 
 import "github.com/firestuff/automana/headers"
+import "github.com/firestuff/automana/metrics"
 
 type Client struct {
-	client                *http.Client
-	rateLimit             *RateLimit
-	concurrencyLimitRead  *ConcurrencyLimit
-	concurrencyLimitWrite *ConcurrencyLimit
+	client      *http.Client
+	baseURL     string
+	tokenSource TokenSource
+	headers     headers.Headers
+	limits      *limits
+	limitsMu    sync.Mutex
+	coalescer   *coalescer
+	retryPolicy *RetryPolicy
+	cache       *cache
+
+	metrics           *clientMetrics
+	metricsRegistries map[*metrics.Registry]bool
+	metricsMu         sync.Mutex
 }
 
 type errorDetails struct {
 	Message string `json:"message"`
+	Help    string `json:"help"`
 }
 
 type errorResponse struct {
@@ -36,66 +51,124 @@ type nextPage struct {
 }
 
 func NewClient(token string) *Client {
+	return NewClientWithBaseURL(token, defaultBaseURL)
+}
+
+func NewClientWithBaseURL(token, baseURL string) *Client {
+	return NewClientWithTokenSource(NewStaticTokenSource(token), baseURL)
+}
+
+func NewClientWithTokenSource(ts TokenSource, baseURL string) *Client {
 	c := &Client{
-		client:                &http.Client{},
-		rateLimit:             NewRateLimitPerMinute(600, 10),
-		concurrencyLimitRead:  NewConcurrencyLimit(50),
-		concurrencyLimitWrite: NewConcurrencyLimit(15),
+		client:      &http.Client{},
+		baseURL:     baseURL,
+		tokenSource: ts,
+		limits:      newLimits(),
+		coalescer:   newCoalescer(),
+		retryPolicy: NewDefaultRetryPolicy(),
+		cache:       newCache(NewDefaultCacheTTL()),
 	}
 
-	hdrs := headers.NewHeaders(c.client)
-	hdrs.Add("Accept", "application/json")
-	hdrs.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	c.headers = headers.NewHeaders(c.client)
+	c.headers.Add("Accept", "application/json")
+	c.headers.Set("User-Agent", defaultUserAgent())
 
 	return c
 }
 
+// NewClientFromEnv uses the personal access token in ASANA_TOKEN if set,
+// otherwise OAuth (see NewOAuthConfigFromEnv) with the token stored in
+// ASANA_OAUTH_TOKEN_FILE
 func NewClientFromEnv() *Client {
-	return NewClient(os.Getenv("ASANA_TOKEN"))
+	token := os.Getenv("ASANA_TOKEN")
+	if token != "" {
+		return NewClient(token)
+	}
+
+	store := NewFileOAuthTokenStore(os.Getenv("ASANA_OAUTH_TOKEN_FILE"))
+	return NewClientWithTokenSource(NewOAuthTokenSource(NewOAuthConfigFromEnv(), store), defaultBaseURL)
+}
+
+// HTTPClient is exposed so that transports (e.g. recorder) can wrap it
+func (c *Client) HTTPClient() *http.Client {
+	return c.client
+}
+
+func (c *Client) SetRetryPolicy(rp *RetryPolicy) {
+	c.retryPolicy = rp
+}
+
+// SetCacheTTL replaces the metadata cache TTLs, discarding existing entries
+func (c *Client) SetCacheTTL(ttl *CacheTTL) {
+	c.cache.reset(ttl)
 }
 
-const baseURL = "https://app.asana.com/api/1.0/"
+func (c *Client) InvalidateCache() {
+	c.cache.invalidateAll()
+}
+
+const defaultBaseURL = "https://app.asana.com/api/1.0/"
 const perPage = 100
 
-func (c *Client) get(path string, values *url.Values, out interface{}) error {
+func (c *Client) get(ctx context.Context, path string, values *url.Values, out interface{}) error {
 	if values == nil {
 		values = &url.Values{}
 	}
 	values.Set("limit", fmt.Sprintf("%d", perPage))
 
-	url := fmt.Sprintf("%s%s?%s", baseURL, path, values.Encode())
+	return c.getUnpaginated(ctx, path, values, out)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
+// getUnpaginated is get for endpoints that don't accept limit
+func (c *Client) getUnpaginated(ctx context.Context, path string, values *url.Values, out interface{}) error {
+	return c.getClass(ctx, CostRead, nil, path, values, out)
+}
 
-	c.rateLimit.Acquire1()
-	c.concurrencyLimitRead.Acquire1()
-	resp, err := c.client.Do(req)
-	c.concurrencyLimitRead.Release1()
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// search is get for search endpoints, which also draw from rateLimitSearch
+func (c *Client) search(ctx context.Context, rateLimitSearch *RateLimit, path string, values *url.Values, out interface{}) error {
+	values.Set("limit", fmt.Sprintf("%d", perPage))
 
-	err = c.rateLimit.MaybeRetryAfter(resp)
-	if err != nil {
-		return err
+	return c.getClass(ctx, CostSearch, rateLimitSearch, path, values, out)
+}
+
+func (c *Client) getClass(ctx context.Context, class CostClass, classRateLimit *RateLimit, path string, values *url.Values, out interface{}) error {
+	if values == nil {
+		values = &url.Values{}
 	}
 
-	dec := json.NewDecoder(resp.Body)
+	url := fmt.Sprintf("%s%s?%s", c.baseURL, path, values.Encode())
 
-	if resp.StatusCode != 200 {
-		errorResp := &errorResponse{}
-		err = dec.Decode(errorResp)
+	fetch := func() ([]byte, error) {
+		resp, err := c.do(ctx, "GET", url, nil, class, classRateLimit)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if !isSuccess(resp) {
+			return nil, newAPIError("GET", path, resp)
 		}
-		return fmt.Errorf("%s: %s", resp.Status, errorResp.Errors[0].Message)
+
+		return ioutil.ReadAll(resp.Body)
 	}
 
-	err = dec.Decode(out)
+	var body []byte
+	var err error
+
+	if changesResponse(ctx) {
+		// Must be sent as this caller asked, not shared
+		body, err = fetch()
+	} else {
+		// Concurrent periodics often ask for the same thing at the same time
+		body, err = c.coalescer.do(ctx, url, fetch)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Each caller decodes its own copy, so callers can't see each other's
+	// changes to the result
+	err = json.Unmarshal(body, out)
 	if err != nil {
 		return err
 	}
@@ -103,46 +176,41 @@ func (c *Client) get(path string, values *url.Values, out interface{}) error {
 	return nil
 }
 
-func (c *Client) post(path string, body interface{}, out interface{}) error {
-	return c.doWithBody("POST", path, body, out)
+func (c *Client) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	return c.doWithBody(ctx, "POST", path, body, out)
 }
 
-func (c *Client) put(path string, body interface{}, out interface{}) error {
-	return c.doWithBody("PUT", path, body, out)
+func (c *Client) put(ctx context.Context, path string, body interface{}, out interface{}) error {
+	return c.doWithBody(ctx, "PUT", path, body, out)
 }
 
-func (c *Client) doWithBody(method string, path string, body interface{}, out interface{}) error {
-	url := fmt.Sprintf("%s%s", baseURL, path)
+func (c *Client) delete(ctx context.Context, path string, out interface{}) error {
+	return c.doWithBody(ctx, "DELETE", path, nil, out)
+}
+
+func (c *Client) doWithBody(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	url := fmt.Sprintf("%s%s", c.baseURL, path)
 
 	buf := &bytes.Buffer{}
-	enc := json.NewEncoder(buf)
-	enc.SetEscapeHTML(false)
 
-	err := enc.Encode(body)
-	if err != nil {
-		return err
-	}
+	if body != nil {
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
 
-	req, err := http.NewRequest(method, url, buf)
-	if err != nil {
-		return err
+		err := enc.Encode(body)
+		if err != nil {
+			return err
+		}
 	}
 
-	c.rateLimit.Acquire1()
-	c.concurrencyLimitWrite.Acquire1()
-	resp, err := c.client.Do(req)
-	c.concurrencyLimitWrite.Release1()
+	resp, err := c.do(ctx, method, url, buf.Bytes(), CostWrite, nil)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		return fmt.Errorf("%s: %s", resp.Status, string(body))
+	if !isSuccess(resp) {
+		return newAPIError(method, path, resp)
 	}
 
 	dec := json.NewDecoder(resp.Body)
@@ -153,3 +221,111 @@ func (c *Client) doWithBody(method string, path string, body interface{}, out in
 
 	return nil
 }
+
+// do sends the request, retrying according to c.retryPolicy. Each attempt
+// draws from the general rate limit and, if not nil, classRateLimit, which
+// also takes the blame for 429s. The caller must close the returned
+// response body.
+func (c *Client) do(ctx context.Context, method string, url string, body []byte, class CostClass, classRateLimit *RateLimit) (*http.Response, error) {
+	refreshed := false
+	endpoint := c.endpointOf(url)
+
+	// Shared by retries, so they can be correlated
+	requestID := headers.FromContext(ctx).Get("X-Request-Id")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	limits := c.getLimits()
+	concurrencyLimit := limits.concurrencyLimit(class)
+	rateLimit := limits.general()
+
+	throttled := rateLimit
+	if classRateLimit != nil {
+		throttled = classRateLimit
+	}
+
+	for attempt := 1; ; attempt++ {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := c.tokenSource.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("X-Request-Id", requestID)
+
+		err = rateLimit.Acquire(ctx, class)
+		if err != nil {
+			return nil, err
+		}
+
+		if classRateLimit != nil {
+			err = classRateLimit.Acquire(ctx, class)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = concurrencyLimit.Acquire1(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := c.client.Do(req)
+		concurrencyLimit.Release1()
+		c.observeRequest(method, endpoint, start, resp, err)
+
+		if err == nil {
+			throttled.Observe(resp)
+
+			if throttled != rateLimit && isSuccess(resp) {
+				rateLimit.Succeeded()
+			}
+		}
+
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && !refreshed && c.tokenSource.Invalidate(token) {
+			// Retry once with a fresh token, whatever the retry policy
+			refreshed = true
+			attempt--
+			c.observeRetry(method, endpoint)
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			continue
+		}
+
+		if ctx.Err() != nil || !c.retryPolicy.shouldRetry(method, attempt, resp, err) {
+			if err != nil && !isContextError(err) {
+				err = fmt.Errorf("%w (request %s)", err, requestID)
+			}
+			return resp, err
+		}
+
+		wait := c.retryPolicy.backoff(attempt, resp)
+		c.observeRetry(method, endpoint)
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		err = sleepContext(ctx, wait)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isSuccess(resp *http.Response) bool {
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
@@ -0,0 +1,81 @@
+package client
+
+import "context"
+import "errors"
+import "sync"
+
+// coalescer shares the result of one in-flight call among all concurrent
+// callers with the same key
+type coalescer struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+var errFetchPanicked = errors.New("coalesced request panicked")
+
+type flight struct {
+	done chan bool
+	body []byte
+	err  error
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{
+		flights: map[string]*flight{},
+	}
+}
+
+// do calls fetch, unless a call for key is already in flight, in which case
+// it waits for and returns that call's result. Callers must not modify the
+// returned slice.
+func (co *coalescer) do(ctx context.Context, key string, fetch func() ([]byte, error)) ([]byte, error) {
+	for {
+		co.mu.Lock()
+		f, found := co.flights[key]
+		if !found {
+			f = &flight{
+				done: make(chan bool),
+			}
+			co.flights[key] = f
+			co.mu.Unlock()
+
+			co.lead(key, f, fetch)
+
+			return f.body, f.err
+		}
+		co.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-f.done:
+		}
+
+		if isContextError(f.err) && ctx.Err() == nil {
+			// The leader gave up, but we haven't
+			continue
+		}
+
+		return f.body, f.err
+	}
+}
+
+// lead runs fetch for f, then releases its waiters even if fetch panics
+func (co *coalescer) lead(key string, f *flight, fetch func() ([]byte, error)) {
+	// Seen by waiters if fetch panics; the panic itself stays with the leader
+	f.err = errFetchPanicked
+
+	defer func() {
+		co.mu.Lock()
+		delete(co.flights, key)
+		co.mu.Unlock()
+
+		close(f.done)
+	}()
+
+	f.body, f.err = fetch()
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
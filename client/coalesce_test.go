@@ -0,0 +1,137 @@
+package client
+
+import "context"
+import "sync"
+import "testing"
+import "time"
+
+func TestCoalescerShares(t *testing.T) {
+	co := newCoalescer()
+	ctx := context.Background()
+
+	calls := 0
+	release := make(chan bool)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			body, err := co.do(ctx, "key", func() ([]byte, error) {
+				calls++
+				<-release
+				return []byte("body"), nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+
+			if string(body) != "body" {
+				t.Errorf("body %q", body)
+			}
+		}()
+	}
+
+	// Let every caller join the flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("%d fetches, want 1", calls)
+	}
+}
+
+func TestCoalescerLeaderCanceled(t *testing.T) {
+	co := newCoalescer()
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	started := make(chan bool)
+	result := make(chan string)
+
+	go func() {
+		_, _ = co.do(leaderCtx, "key", func() ([]byte, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return nil, leaderCtx.Err()
+		})
+	}()
+
+	<-started
+
+	go func() {
+		body, err := co.do(context.Background(), "key", func() ([]byte, error) {
+			return []byte("retried"), nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		result <- string(body)
+	}()
+
+	// Let the waiter join the flight
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case body := <-result:
+		if body != "retried" {
+			t.Errorf("body %q, want retried", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter stuck after the leader was canceled")
+	}
+}
+
+func TestCoalescerPanic(t *testing.T) {
+	co := newCoalescer()
+	ctx := context.Background()
+
+	started := make(chan bool)
+	release := make(chan bool)
+	result := make(chan error)
+
+	go func() {
+		defer func() {
+			_ = recover()
+		}()
+
+		_, _ = co.do(ctx, "key", func() ([]byte, error) {
+			close(started)
+			<-release
+			panic("fetch failed")
+		})
+	}()
+
+	<-started
+
+	go func() {
+		_, err := co.do(ctx, "key", func() ([]byte, error) {
+			return []byte("body"), nil
+		})
+		result <- err
+	}()
+
+	// Let the waiter join the flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-result:
+		if err != errFetchPanicked {
+			t.Errorf("err %v, want %v", err, errFetchPanicked)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter stuck after the leader panicked")
+	}
+
+	// The key is free again
+	body, err := co.do(ctx, "key", func() ([]byte, error) {
+		return []byte("body"), nil
+	})
+	if err != nil || string(body) != "body" {
+		t.Errorf("got %q, %v after panic", body, err)
+	}
+}
@@ -1,11 +1,13 @@
 package client
 
 import "context"
+import "sync/atomic"
 
 import "golang.org/x/sync/semaphore"
 
 type ConcurrencyLimit struct {
-	sem *semaphore.Weighted
+	sem   *semaphore.Weighted
+	inUse int64
 }
 
 func NewConcurrencyLimit(limit int64) *ConcurrencyLimit {
@@ -14,15 +16,18 @@ func NewConcurrencyLimit(limit int64) *ConcurrencyLimit {
 	}
 }
 
-func (cl *ConcurrencyLimit) Acquire1() {
-	cl.AcquireN(1)
+func (cl *ConcurrencyLimit) Acquire1(ctx context.Context) error {
+	return cl.AcquireN(ctx, 1)
 }
 
-func (cl *ConcurrencyLimit) AcquireN(cost int64) {
-	err := cl.sem.Acquire(context.TODO(), cost)
+func (cl *ConcurrencyLimit) AcquireN(ctx context.Context, cost int64) error {
+	err := cl.sem.Acquire(ctx, cost)
 	if err != nil {
-		panic(err)
+		return err
 	}
+
+	atomic.AddInt64(&cl.inUse, cost)
+	return nil
 }
 
 func (cl *ConcurrencyLimit) Release1() {
@@ -30,5 +35,10 @@ func (cl *ConcurrencyLimit) Release1() {
 }
 
 func (cl *ConcurrencyLimit) ReleaseN(cost int64) {
+	atomic.AddInt64(&cl.inUse, -cost)
 	cl.sem.Release(cost)
 }
+
+func (cl *ConcurrencyLimit) InUse() int64 {
+	return atomic.LoadInt64(&cl.inUse)
+}
@@ -0,0 +1,337 @@
+package client
+
+import "context"
+import "fmt"
+import "net/url"
+import "strings"
+import "time"
+
+import "cloud.google.com/go/civil"
+
+type CustomField struct {
+	GID             string        `json:"gid,omitempty"`
+	Name            string        `json:"name,omitempty"`
+	Type            string        `json:"type,omitempty"`
+	ResourceSubtype string        `json:"resource_subtype,omitempty"`
+	DisplayValue    *string       `json:"display_value,omitempty"`
+	TextValue       *string       `json:"text_value,omitempty"`
+	NumberValue     *float64      `json:"number_value,omitempty"`
+	EnumValue       *EnumOption   `json:"enum_value,omitempty"`
+	MultiEnumValues []*EnumOption `json:"multi_enum_values,omitempty"`
+	DateValue       *DateValue    `json:"date_value,omitempty"`
+	PeopleValue     []*User       `json:"people_value,omitempty"`
+
+	// Only in definitions, not in values on a Task
+	EnumOptions []*EnumOption `json:"enum_options,omitempty"`
+	Precision   int           `json:"precision,omitempty"`
+}
+
+type EnumOption struct {
+	GID     string `json:"gid,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Enabled bool   `json:"enabled,omitempty"`
+	Color   string `json:"color,omitempty"`
+}
+
+type DateValue struct {
+	Date     string `json:"date,omitempty"`
+	DateTime string `json:"date_time,omitempty"`
+}
+
+// CustomFieldSetting is a custom field's attachment to a project
+type CustomFieldSetting struct {
+	GID         string       `json:"gid"`
+	CustomField *CustomField `json:"custom_field"`
+	Project     *Project     `json:"project"`
+	IsImportant bool         `json:"is_important"`
+}
+
+type customFieldsResponse struct {
+	Data     []*CustomField `json:"data"`
+	NextPage *nextPage      `json:"next_page"`
+}
+
+type customFieldSettingsResponse struct {
+	Data     []*CustomFieldSetting `json:"data"`
+	NextPage *nextPage             `json:"next_page"`
+}
+
+var customFieldOptFields = []string{
+	"enum_options.color",
+	"enum_options.enabled",
+	"enum_options.name",
+	"name",
+	"precision",
+	"resource_subtype",
+	"type",
+}
+
+func (wc *WorkspaceClient) GetCustomFields(ctx context.Context) ([]*CustomField, error) {
+	path := fmt.Sprintf("workspaces/%s/custom_fields", wc.workspace.GID)
+
+	cache := wc.client.cache
+	cfs, err := cache.getOrFetch(ctx, path, cache.ttls().CustomFields, func() (interface{}, error) {
+		return wc.fetchCustomFields(ctx, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cfs.([]*CustomField), nil
+}
+
+func (wc *WorkspaceClient) fetchCustomFields(ctx context.Context, path string) ([]*CustomField, error) {
+	ret := []*CustomField{}
+
+	values := &url.Values{}
+	values.Set("opt_fields", strings.Join(customFieldOptFields, ","))
+
+	for {
+		resp := &customFieldsResponse{}
+		err := wc.client.get(ctx, path, values, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, resp.Data...)
+
+		if resp.NextPage == nil {
+			break
+		}
+
+		values.Set("offset", resp.NextPage.Offset)
+	}
+
+	return ret, nil
+}
+
+func (wc *WorkspaceClient) GetCustomFieldsByName(ctx context.Context) (map[string]*CustomField, error) {
+	cfs, err := wc.GetCustomFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfsByName := map[string]*CustomField{}
+	for _, cf := range cfs {
+		cfsByName[cf.Name] = cf
+	}
+
+	return cfsByName, nil
+}
+
+func (wc *WorkspaceClient) GetCustomFieldByName(ctx context.Context, name string) (*CustomField, error) {
+	cfsByName, err := wc.GetCustomFieldsByName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cf, found := cfsByName[name]
+	if !found {
+		// Maybe our cached list is stale
+		wc.InvalidateCustomFields()
+
+		cfsByName, err = wc.GetCustomFieldsByName(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cf, found = cfsByName[name]
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Custom field '%s' not found", name)
+	}
+
+	return cf, nil
+}
+
+func (wc *WorkspaceClient) InvalidateCustomFields() {
+	wc.client.cache.invalidate(fmt.Sprintf("workspaces/%s/custom_fields", wc.workspace.GID))
+}
+
+func (wc *WorkspaceClient) GetCustomFieldSettings(ctx context.Context, project *Project) ([]*CustomFieldSetting, error) {
+	path := fmt.Sprintf("projects/%s/custom_field_settings", project.GID)
+
+	cache := wc.client.cache
+	settings, err := cache.getOrFetch(ctx, path, cache.ttls().CustomFields, func() (interface{}, error) {
+		return wc.fetchCustomFieldSettings(ctx, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return settings.([]*CustomFieldSetting), nil
+}
+
+func (wc *WorkspaceClient) fetchCustomFieldSettings(ctx context.Context, path string) ([]*CustomFieldSetting, error) {
+	ret := []*CustomFieldSetting{}
+
+	optFields := []string{
+		"is_important",
+		"project.name",
+	}
+	for _, field := range customFieldOptFields {
+		optFields = append(optFields, fmt.Sprintf("custom_field.%s", field))
+	}
+
+	values := &url.Values{}
+	values.Set("opt_fields", strings.Join(optFields, ","))
+
+	for {
+		resp := &customFieldSettingsResponse{}
+		err := wc.client.get(ctx, path, values, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, resp.Data...)
+
+		if resp.NextPage == nil {
+			break
+		}
+
+		values.Set("offset", resp.NextPage.Offset)
+	}
+
+	return ret, nil
+}
+
+func (cf *CustomField) String() string {
+	if cf.DisplayValue == nil {
+		return fmt.Sprintf("%s (%s)", cf.GID, cf.Name)
+	}
+
+	return fmt.Sprintf("%s (%s = %s)", cf.GID, cf.Name, *cf.DisplayValue)
+}
+
+// EnumOptionByName only works on definitions, which carry EnumOptions
+func (cf *CustomField) EnumOptionByName(name string) (*EnumOption, error) {
+	for _, opt := range cf.EnumOptions {
+		if opt.Name == name {
+			return opt, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Option '%s' not found in custom field '%s'", name, cf.Name)
+}
+
+// EncodeValue converts v into the form Asana expects when writing this
+// field with TaskPatch.SetCustomField:
+//
+//	text:       string
+//	number:     any int or float type
+//	enum:       option name
+//	multi_enum: []string of option names
+//	date:       civil.Date or time.Time
+//	people:     []*User
+//
+// nil clears the field, whatever its type. cf must be a definition (from
+// GetCustomFields) for enum lookups.
+func (cf *CustomField) EncodeValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch cf.subtype() {
+	case "text":
+		s, ok := v.(string)
+		if !ok {
+			return nil, cf.typeError(v)
+		}
+		return s, nil
+
+	case "number":
+		switch n := v.(type) {
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case float32:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		default:
+			return nil, cf.typeError(v)
+		}
+
+	case "enum":
+		name, ok := v.(string)
+		if !ok {
+			return nil, cf.typeError(v)
+		}
+
+		opt, err := cf.EnumOptionByName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		return opt.GID, nil
+
+	case "multi_enum":
+		names, ok := v.([]string)
+		if !ok {
+			return nil, cf.typeError(v)
+		}
+
+		gids := []string{}
+		for _, name := range names {
+			opt, err := cf.EnumOptionByName(name)
+			if err != nil {
+				return nil, err
+			}
+			gids = append(gids, opt.GID)
+		}
+
+		return gids, nil
+
+	case "date":
+		switch d := v.(type) {
+		case civil.Date:
+			return &DateValue{Date: d.String()}, nil
+		case time.Time:
+			return &DateValue{DateTime: d.UTC().Format(time.RFC3339)}, nil
+		default:
+			return nil, cf.typeError(v)
+		}
+
+	case "people":
+		users, ok := v.([]*User)
+		if !ok {
+			return nil, cf.typeError(v)
+		}
+
+		gids := []string{}
+		for _, user := range users {
+			gids = append(gids, user.GID)
+		}
+
+		return gids, nil
+
+	default:
+		return nil, fmt.Errorf("Custom field '%s' has unsupported type '%s'", cf.Name, cf.subtype())
+	}
+}
+
+func (cf *CustomField) subtype() string {
+	if cf.ResourceSubtype != "" {
+		return cf.ResourceSubtype
+	}
+
+	return cf.Type
+}
+
+func (cf *CustomField) typeError(v interface{}) error {
+	return fmt.Errorf("Custom field '%s' is %s; can't set it to %T", cf.Name, cf.subtype(), v)
+}
+
+// CustomFieldByName returns the task's value for the named field, or nil if
+// the field isn't on the task
+func (t *Task) CustomFieldByName(name string) *CustomField {
+	for _, cf := range t.CustomFields {
+		if cf.Name == name {
+			return cf
+		}
+	}
+
+	return nil
+}
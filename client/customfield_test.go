@@ -0,0 +1,192 @@
+package client_test
+
+import "context"
+import "strings"
+import "testing"
+import "time"
+
+import "cloud.google.com/go/civil"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+// customFieldValue renders a stored value for comparison, "" if unset
+func customFieldValue(t *asanatest.Task, gid string) string {
+	for _, cf := range t.CustomFields {
+		if cf.GID != gid {
+			continue
+		}
+
+		if len(cf.MultiEnumValues) > 0 {
+			names := []string{}
+			for _, opt := range cf.MultiEnumValues {
+				names = append(names, opt.Name)
+			}
+			return strings.Join(names, ",")
+		}
+
+		if cf.DisplayValue != nil {
+			return *cf.DisplayValue
+		}
+	}
+
+	return ""
+}
+
+func TestEncodeValue(t *testing.T) {
+	options := []*client.EnumOption{
+		{Name: "Low", Enabled: true},
+		{Name: "High", Enabled: true},
+	}
+
+	tests := []struct {
+		subtype string
+		value   interface{}
+		want    string
+	}{
+		{"text", "hello", "hello"},
+		{"number", 3, "3"},
+		{"number", int64(4), "4"},
+		{"number", float32(1.5), "1.5"},
+		{"number", 2.25, "2.25"},
+		{"enum", "High", "High"},
+		{"multi_enum", []string{"Low", "High"}, "Low,High"},
+		{"date", civil.Date{Year: 2024, Month: 3, Day: 1}, "2024-03-01"},
+		{"date", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC), "2024-03-01T09:30:00Z"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.subtype, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+
+			s.AddCustomField(wrk, &client.CustomField{
+				Name:            "Field",
+				ResourceSubtype: test.subtype,
+				EnumOptions:     options,
+			})
+
+			ctx := context.Background()
+
+			wc, err := s.Client().InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cf, err := wc.GetCustomFieldByName(ctx, "Field")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, step := range []struct {
+				value interface{}
+				want  string
+			}{
+				{test.value, test.want},
+				{nil, ""},
+			} {
+				encoded, err := cf.EncodeValue(step.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = wc.UpdateTask(ctx, &client.Task{GID: gid}, client.NewTaskPatch().SetCustomField(cf.GID, encoded))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := customFieldValue(s.GetTask(gid), cf.GID)
+				if got != step.want {
+					t.Errorf("set to %#v: got %q, want %q", step.value, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodePeopleValue(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	wrk := s.AddWorkspace("Work")
+	alice := s.AddUser("Alice", "alice@example.com")
+	bob := s.AddUser("Bob", "bob@example.com")
+	gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+
+	s.AddCustomField(wrk, &client.CustomField{
+		Name:            "Reviewers",
+		ResourceSubtype: "people",
+	})
+
+	ctx := context.Background()
+
+	wc, err := s.Client().InWorkspace(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cf, err := wc.GetCustomFieldByName(ctx, "Reviewers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		value interface{}
+		want  string
+	}{
+		{[]*client.User{alice, bob}, "Alice, Bob"},
+		{nil, ""},
+	} {
+		encoded, err := cf.EncodeValue(step.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = wc.UpdateTask(ctx, &client.Task{GID: gid}, client.NewTaskPatch().SetCustomField(cf.GID, encoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := customFieldValue(s.GetTask(gid), cf.GID)
+		if got != step.want {
+			t.Errorf("set to %v: got %q, want %q", step.value, got, step.want)
+		}
+	}
+}
+
+func TestEncodeValueErrors(t *testing.T) {
+	options := []*client.EnumOption{
+		{GID: "1", Name: "Low"},
+	}
+
+	tests := []struct {
+		subtype string
+		value   interface{}
+	}{
+		{"text", 1},
+		{"number", "1"},
+		{"enum", "Missing"},
+		{"enum", 1},
+		{"multi_enum", "Low"},
+		{"multi_enum", []string{"Low", "Missing"}},
+		{"date", "2024-03-01"},
+		{"people", []string{"1"}},
+		{"formula", "x"},
+	}
+
+	for _, test := range tests {
+		cf := &client.CustomField{
+			Name:            "Field",
+			ResourceSubtype: test.subtype,
+			EnumOptions:     options,
+		}
+
+		_, err := cf.EncodeValue(test.value)
+		if err == nil {
+			t.Errorf("%s accepted %#v", test.subtype, test.value)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import "encoding/json"
+import "errors"
+import "fmt"
+import "io/ioutil"
+import "net/http"
+import "strings"
+
+var ErrNotFound = errors.New("not found")
+var ErrForbidden = errors.New("forbidden")
+var ErrRateLimited = errors.New("rate limited")
+var ErrServer = errors.New("server error")
+
+// APIError is returned for any non-2xx response from Asana
+type APIError struct {
+	StatusCode int
+	Status     string
+	Method     string
+	Path       string
+	Messages   []string
+	Help       []string
+
+	// Empty for batch actions
+	RequestID      string
+	AsanaRequestID string
+
+	body []byte
+}
+
+// MultiError is several independent failures, like the failed actions of a
+// batch. errors.Is and errors.As match any of them.
+type MultiError []error
+
+func newAPIError(method, path string, resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	apiErr := newAPIErrorFromBody(method, path, resp.StatusCode, resp.Status, body)
+	apiErr.AsanaRequestID = resp.Header.Get("X-Asana-Request-Id")
+	if resp.Request != nil {
+		apiErr.RequestID = resp.Request.Header.Get("X-Request-Id")
+	}
+
+	return apiErr
+}
+
+func newAPIErrorFromBody(method, path string, statusCode int, status string, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Status:     status,
+		Method:     method,
+		Path:       path,
+		body:       body,
+	}
+
+	errorResp := &errorResponse{}
+	err := json.Unmarshal(body, errorResp)
+	if err == nil && len(errorResp.Errors) > 0 {
+		for _, details := range errorResp.Errors {
+			apiErr.Messages = append(apiErr.Messages, details.Message)
+			if details.Help != "" {
+				apiErr.Help = append(apiErr.Help, details.Help)
+			}
+		}
+	} else if len(body) > 0 {
+		apiErr.Messages = append(apiErr.Messages, strings.TrimSpace(string(body)))
+	}
+
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Status)
+
+	if len(e.Messages) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, strings.Join(e.Messages, "; "))
+	}
+
+	if e.RequestID != "" {
+		msg = fmt.Sprintf("%s (request %s)", msg, e.RequestID)
+	}
+
+	if e.AsanaRequestID != "" {
+		msg = fmt.Sprintf("%s (asana request %s)", msg, e.AsanaRequestID)
+	}
+
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+
+	case ErrServer:
+		return e.StatusCode >= 500
+
+	default:
+		return false
+	}
+}
+
+func (e MultiError) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	msgs := []string{}
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("%d errors: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e MultiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e MultiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package client_test
+
+import "context"
+import "errors"
+import "fmt"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestAPIErrorSentinels(t *testing.T) {
+	sentinels := []error{
+		client.ErrNotFound,
+		client.ErrForbidden,
+		client.ErrRateLimited,
+		client.ErrServer,
+	}
+
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{400, nil},
+		{403, client.ErrForbidden},
+		{404, client.ErrNotFound},
+		{429, client.ErrRateLimited},
+		{500, client.ErrServer},
+		{503, client.ErrServer},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d", test.status), func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+
+			c := s.Client()
+			c.SetRetryPolicy(client.NewNoRetryPolicy())
+
+			ctx := context.Background()
+
+			wc, err := c.InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s.FailNext(1, test.status, "")
+
+			_, err = wc.GetTask(ctx, gid)
+			if err == nil {
+				t.Fatal("no error")
+			}
+
+			for _, sentinel := range sentinels {
+				if errors.Is(err, sentinel) != (sentinel == test.want) {
+					t.Errorf("errors.Is(%v, %v) = %t", err, sentinel, errors.Is(err, sentinel))
+				}
+			}
+
+			apiErr := &client.APIError{}
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("%v isn't an APIError", err)
+			}
+
+			if apiErr.StatusCode != test.status {
+				t.Errorf("StatusCode %d, want %d", apiErr.StatusCode, test.status)
+			}
+
+			wantPath := fmt.Sprintf("tasks/%s", gid)
+			if apiErr.Method != "GET" || apiErr.Path != wantPath {
+				t.Errorf("request %s %s, want GET %s", apiErr.Method, apiErr.Path, wantPath)
+			}
+
+			if len(apiErr.Messages) == 0 || apiErr.RequestID == "" || apiErr.AsanaRequestID == "" {
+				t.Errorf("incomplete APIError: %#v", apiErr)
+			}
+		})
+	}
+}
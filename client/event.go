@@ -0,0 +1,254 @@
+package client
+
+import "context"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "io/ioutil"
+import "net/http"
+import "net/url"
+import "os"
+import "path/filepath"
+import "sync"
+import "time"
+
+// ErrSyncReset is delivered when Asana discards our sync token; events
+// since the last successful sync were lost, so callers should rescan.
+var ErrSyncReset = errors.New("sync token reset")
+
+type Event struct {
+	User      *User          `json:"user"`
+	Resource  *EventResource `json:"resource"`
+	Parent    *EventResource `json:"parent"`
+	Action    string         `json:"action"`
+	CreatedAt string         `json:"created_at"`
+	Change    *EventChange   `json:"change"`
+}
+
+type EventResource struct {
+	GID             string `json:"gid"`
+	Name            string `json:"name"`
+	ResourceType    string `json:"resource_type"`
+	ResourceSubtype string `json:"resource_subtype"`
+}
+
+type EventChange struct {
+	Field        string          `json:"field"`
+	Action       string          `json:"action"`
+	NewValue     json.RawMessage `json:"new_value"`
+	AddedValue   json.RawMessage `json:"added_value"`
+	RemovedValue json.RawMessage `json:"removed_value"`
+}
+
+type eventsResponse struct {
+	Data    []*Event `json:"data"`
+	Sync    string   `json:"sync"`
+	HasMore bool     `json:"has_more"`
+}
+
+type syncErrorResponse struct {
+	Sync string `json:"sync"`
+}
+
+// SyncTokenStore persists the latest sync token per resource GID
+type SyncTokenStore interface {
+	Get(resource string) (string, error)
+	Set(resource, token string) error
+}
+
+type memorySyncTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+type fileSyncTokenStore struct {
+	dir string
+}
+
+func NewMemorySyncTokenStore() SyncTokenStore {
+	return &memorySyncTokenStore{
+		tokens: map[string]string{},
+	}
+}
+
+// NewFileSyncTokenStore stores one file per resource in dir
+func NewFileSyncTokenStore(dir string) (SyncTokenStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSyncTokenStore{
+		dir: dir,
+	}, nil
+}
+
+// GetEvents returns all events on resource since sync, following has_more,
+// and the new sync token. An empty sync just obtains a token.
+func (wc *WorkspaceClient) GetEvents(ctx context.Context, resource string, sync string) ([]*Event, string, error) {
+	ret := []*Event{}
+
+	for {
+		values := &url.Values{}
+		values.Set("resource", resource)
+		if sync != "" {
+			values.Set("sync", sync)
+		}
+
+		resp := &eventsResponse{}
+		err := wc.client.getUnpaginated(ctx, "events", values, resp)
+		if err != nil {
+			apiErr := &APIError{}
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusPreconditionFailed {
+				return nil, "", err
+			}
+
+			syncResp := &syncErrorResponse{}
+			err = json.Unmarshal(apiErr.body, syncResp)
+			if err != nil {
+				return nil, "", err
+			}
+
+			if sync == "" {
+				// Expected on first call
+				return ret, syncResp.Sync, nil
+			}
+
+			return nil, syncResp.Sync, ErrSyncReset
+		}
+
+		ret = append(ret, resp.Data...)
+		sync = resp.Sync
+
+		if !resp.HasMore {
+			break
+		}
+	}
+
+	return ret, sync, nil
+}
+
+// WatchEvents polls resource every interval and delivers new events until
+// ctx is cancelled, at which point both channels are closed. Sync tokens
+// are loaded from and saved to store. Errors (including ErrSyncReset) are
+// dropped if the previous one hasn't been received yet.
+func (wc *WorkspaceClient) WatchEvents(ctx context.Context, resource string, store SyncTokenStore, interval time.Duration) (<-chan *Event, <-chan error) {
+	events := make(chan *Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+
+		for {
+			err := wc.pollEvents(ctx, resource, store, events)
+			if err != nil && ctx.Err() == nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+
+			if sleepContext(ctx, interval) != nil {
+				return
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+func (wc *WorkspaceClient) pollEvents(ctx context.Context, resource string, store SyncTokenStore, events chan<- *Event) error {
+	sync, err := store.Get(resource)
+	if err != nil {
+		return err
+	}
+
+	evs, newSync, err := wc.GetEvents(ctx, resource, sync)
+	if err != nil {
+		if newSync != "" {
+			// Expired token; there are no events to lose by moving on
+			storeErr := store.Set(resource, newSync)
+			if storeErr != nil {
+				return storeErr
+			}
+		}
+		return err
+	}
+
+	for _, ev := range evs {
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+			// Unsaved, so these are fetched again next time
+			return ctx.Err()
+		}
+	}
+
+	if newSync == "" {
+		return nil
+	}
+
+	return store.Set(resource, newSync)
+}
+
+func (ev *Event) String() string {
+	ret := fmt.Sprintf("%s %s", ev.Action, ev.Resource)
+
+	if ev.Change != nil {
+		ret = fmt.Sprintf("%s %s", ret, ev.Change.Field)
+	}
+
+	if ev.Parent != nil {
+		ret = fmt.Sprintf("%s in %s", ret, ev.Parent)
+	}
+
+	return ret
+}
+
+func (er *EventResource) String() string {
+	return fmt.Sprintf("%s %s (%s)", er.ResourceType, er.GID, er.Name)
+}
+
+func (s *memorySyncTokenStore) Get(resource string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tokens[resource], nil
+}
+
+func (s *memorySyncTokenStore) Set(resource, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[resource] = token
+	return nil
+}
+
+func (s *fileSyncTokenStore) Get(resource string) (string, error) {
+	token, err := ioutil.ReadFile(s.path(resource))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(token), nil
+}
+
+func (s *fileSyncTokenStore) Set(resource, token string) error {
+	// Write then rename so a crash can't leave a truncated token
+	tmp := fmt.Sprintf("%s.tmp", s.path(resource))
+
+	err := ioutil.WriteFile(tmp, []byte(token), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path(resource))
+}
+
+func (s *fileSyncTokenStore) path(resource string) string {
+	return filepath.Join(s.dir, filepath.Base(resource))
+}
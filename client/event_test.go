@@ -0,0 +1,77 @@
+package client_test
+
+import "context"
+import "testing"
+import "time"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestWatchEventsKeepsUndeliveredEvents(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	wrk := s.AddWorkspace("Work")
+	gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+
+	ctx := context.Background()
+
+	wc, err := s.Client().InWorkspace(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := client.NewMemorySyncTokenStore()
+
+	// The first poll only fetches a sync token
+	watchCtx, cancel := context.WithCancel(ctx)
+	_, errs := wc.WatchEvents(watchCtx, gid, store, 10*time.Millisecond)
+	waitForSyncToken(t, store, gid)
+
+	patch := client.NewTaskPatch()
+	patch.SetName("Renamed")
+
+	_, err = wc.UpdateTask(ctx, &client.Task{GID: gid}, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Let a poll fetch the event, then stop without receiving it
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	for range errs {
+	}
+
+	watchCtx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	events, _ := wc.WatchEvents(watchCtx, gid, store, 10*time.Millisecond)
+
+	select {
+	case ev := <-events:
+		if ev.Change == nil || ev.Change.Field != "name" {
+			t.Errorf("got %s, want name change", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("undelivered event was lost")
+	}
+}
+
+func waitForSyncToken(t *testing.T, store client.SyncTokenStore, resource string) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		token, err := store.Get(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token != "" {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatal("no sync token stored")
+}
@@ -0,0 +1,120 @@
+package client
+
+import "context"
+import "crypto/rand"
+import "encoding/hex"
+import "fmt"
+import "net/http"
+import "runtime/debug"
+import "strings"
+
+import "github.com/firestuff/automana/headers"
+
+const modulePath = "github.com/firestuff/automana"
+
+// ResponseInfo describes one response from Asana, for OnResponse
+type ResponseInfo struct {
+	Method     string
+	URL        string
+	StatusCode int
+
+	// Our X-Request-Id, and Asana's X-Asana-Request-Id to quote to support
+	RequestID      string
+	AsanaRequestID string
+
+	// Asana-Change warnings about upcoming API changes affecting this
+	// request
+	Changes []string
+}
+
+// SetUserAgent replaces the default "automana/<version>"
+func (c *Client) SetUserAgent(ua string) {
+	c.headers.Set("User-Agent", ua)
+}
+
+// EnableDeprecations opts every request into the named Asana API changes
+// early (Asana-Enable)
+func (c *Client) EnableDeprecations(names ...string) {
+	c.headers.Set("Asana-Enable", strings.Join(names, ","))
+}
+
+// DisableDeprecations opts every request out of the named Asana API
+// changes while they are still optional (Asana-Disable)
+func (c *Client) DisableDeprecations(names ...string) {
+	c.headers.Set("Asana-Disable", strings.Join(names, ","))
+}
+
+// OnResponse calls cb with every response, including those that are
+// retried
+func (c *Client) OnResponse(cb func(*ResponseInfo)) {
+	c.headers.OnResponse(func(req *http.Request, resp *http.Response) {
+		cb(&ResponseInfo{
+			Method:         req.Method,
+			URL:            req.URL.String(),
+			StatusCode:     resp.StatusCode,
+			RequestID:      req.Header.Get("X-Request-Id"),
+			AsanaRequestID: resp.Header.Get("X-Asana-Request-Id"),
+			Changes:        resp.Header[http.CanonicalHeaderKey("Asana-Change")],
+		})
+	})
+}
+
+// WithEnableDeprecations is EnableDeprecations for requests made with the
+// returned context
+func WithEnableDeprecations(ctx context.Context, names ...string) context.Context {
+	return headers.WithHeader(ctx, "Asana-Enable", strings.Join(names, ","))
+}
+
+func WithDisableDeprecations(ctx context.Context, names ...string) context.Context {
+	return headers.WithHeader(ctx, "Asana-Disable", strings.Join(names, ","))
+}
+
+// WithRequestID sets the X-Request-Id of requests made with the returned
+// context, instead of a random one per call
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return headers.WithHeader(ctx, "X-Request-Id", id)
+}
+
+// changesResponse reports whether ctx opts into or out of API changes, in
+// which case responses can't be shared with other callers. Other headers,
+// like X-Request-Id, don't change what Asana returns.
+func changesResponse(ctx context.Context) bool {
+	h := headers.FromContext(ctx)
+	return h.Get("Asana-Enable") != "" || h.Get("Asana-Disable") != ""
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+func defaultUserAgent() string {
+	return fmt.Sprintf("automana/%s (+https://%s)", version(), modulePath)
+}
+
+// version is our module version as recorded in the binary, if any
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+
+	mod := &info.Main
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			mod = dep
+		}
+	}
+
+	if mod.Path != modulePath || mod.Version == "" || mod.Version == "(devel)" {
+		return "devel"
+	}
+
+	return mod.Version
+}
@@ -0,0 +1,123 @@
+package client_test
+
+import "context"
+import "sync"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestHeadersChangeDuringRequests(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	s.AddWorkspace("Work")
+
+	c := s.Client()
+	c.SetCacheTTL(client.NewNoCacheTTL())
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := c.GetWorkspaces(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			c.SetUserAgent("test")
+			c.EnableDeprecations("a", "b")
+			c.DisableDeprecations("c")
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestResponseInfo(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	s.AddWorkspace("Work")
+
+	c := s.Client()
+
+	infos := []*client.ResponseInfo{}
+	c.OnResponse(func(info *client.ResponseInfo) {
+		infos = append(infos, info)
+	})
+
+	s.FailNext(1, 500, "0")
+
+	ctx := client.WithRequestID(context.Background(), "my-request")
+
+	_, err := c.GetWorkspaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("got %d responses, want 2", len(infos))
+	}
+
+	for _, info := range infos {
+		if info.RequestID != "my-request" {
+			t.Errorf("request ID %q, want my-request", info.RequestID)
+		}
+
+		if info.AsanaRequestID == "" {
+			t.Errorf("missing Asana request ID")
+		}
+	}
+}
+
+func TestRequestHeadersBypassSharing(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      func(context.Context) context.Context
+		requests int
+	}{
+		{"no headers", func(ctx context.Context) context.Context { return ctx }, 0},
+		{"request ID", func(ctx context.Context) context.Context { return client.WithRequestID(ctx, "a") }, 0},
+		{"Asana-Enable", func(ctx context.Context) context.Context { return client.WithEnableDeprecations(ctx, "new_behavior") }, 1},
+		{"Asana-Disable", func(ctx context.Context) context.Context { return client.WithDisableDeprecations(ctx, "new_behavior") }, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			s.AddWorkspace("Work")
+
+			c := s.Client()
+			ctx := context.Background()
+
+			_, err := c.GetWorkspaces(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			before := countRequests(s, "GET /workspaces")
+
+			_, err = c.GetWorkspaces(test.ctx(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := countRequests(s, "GET /workspaces") - before
+			if got != test.requests {
+				t.Errorf("%d requests sent, want %d", got, test.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package client
+
+import "sync"
+
+// Asana limits are per token, so Clients using the same token should
+// share them (see ShareLimits)
+type limits struct {
+	concurrencyLimitRead  *ConcurrencyLimit
+	concurrencyLimitWrite *ConcurrencyLimit
+
+	// Search quota is per workspace, so survives WorkspaceClients
+	rateLimitSearch map[string]*RateLimit
+
+	// Replaceable by SetRateLimit
+	rateLimit *RateLimit
+
+	mu sync.Mutex
+}
+
+func newLimits() *limits {
+	return &limits{
+		rateLimit:             NewRateLimitPerMinute(600, 10),
+		concurrencyLimitRead:  NewConcurrencyLimit(50),
+		concurrencyLimitWrite: NewConcurrencyLimit(15),
+		rateLimitSearch:       map[string]*RateLimit{},
+	}
+}
+
+// ShareLimits makes c draw from the same rate and concurrency limits as
+// other, including what either has learned from server feedback. Requests
+// already waiting on c's old limits finish against them.
+func (c *Client) ShareLimits(other *Client) {
+	l := other.getLimits()
+
+	c.limitsMu.Lock()
+	defer c.limitsMu.Unlock()
+
+	c.limits = l
+}
+
+// SetRateLimit replaces the general rate limit, e.g. with one sized for a
+// different Asana plan. This affects every Client sharing c's limits.
+func (c *Client) SetRateLimit(rl *RateLimit) {
+	l := c.getLimits()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rateLimit = rl
+}
+
+func (c *Client) getLimits() *limits {
+	c.limitsMu.Lock()
+	defer c.limitsMu.Unlock()
+
+	return c.limits
+}
+
+func (l *limits) general() *RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rateLimit
+}
+
+func (l *limits) search(wrk *Workspace) *RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rl, found := l.rateLimitSearch[wrk.GID]
+	if !found {
+		rl = NewRateLimitPerMinute(60, 60)
+		l.rateLimitSearch[wrk.GID] = rl
+	}
+
+	return rl
+}
+
+func (l *limits) concurrencyLimit(class CostClass) *ConcurrencyLimit {
+	if class == CostWrite {
+		return l.concurrencyLimitWrite
+	}
+
+	return l.concurrencyLimitRead
+}
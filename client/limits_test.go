@@ -0,0 +1,125 @@
+package client_test
+
+import "context"
+import "fmt"
+import "strconv"
+import "sync"
+import "testing"
+import "time"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+import "github.com/firestuff/automana/metrics"
+
+func TestLimitsChangeDuringRequests(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	s.AddWorkspace("Work")
+
+	c := s.Client()
+	c.SetCacheTTL(client.NewNoCacheTTL())
+
+	other := s.Client()
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := c.GetWorkspaces(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			c.ShareLimits(other)
+			c.SetRateLimit(client.NewRateLimit(1000, 1000))
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestCostClasses(t *testing.T) {
+	tests := []struct {
+		name  string
+		class client.CostClass
+		cost  float64
+		want  float64
+	}{
+		{"read default", client.CostRead, 0, 9},
+		{"write default", client.CostWrite, 0, 9},
+		{"search default", client.CostSearch, 0, 9},
+		{"custom cost", client.CostSearch, 3, 7},
+		{"cost above limit", client.CostWrite, 50, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Slow enough that refill doesn't show
+			rl := client.NewRateLimit(0.0001, 10)
+			if test.cost > 0 {
+				rl.SetCost(test.class, test.cost)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := rl.Acquire(ctx, test.class)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := rl.Balance()
+			if got < test.want || got > test.want+0.01 {
+				t.Errorf("balance %f, want %f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSearchLimitSharedByWorkspaceClients(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	wrk := s.AddWorkspace("Work")
+
+	c := s.Client()
+	reg := metrics.NewRegistry()
+	c.SetMetrics(reg, "test")
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		// As rules do on every run
+		wc, err := c.InWorkspace(ctx, "Work")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = wc.Search(ctx, &client.SearchQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sample := fmt.Sprintf("automana_client_search_rate_limit_balance{client=\"test\",workspace=\"%s\"}", wrk.GID)
+
+	balance, err := strconv.ParseFloat(scrape(t, reg)[sample], 64)
+	if err != nil {
+		t.Fatalf("%s: %s", sample, err)
+	}
+
+	// 2 searches, plus a little refill
+	if balance > 58.5 {
+		t.Errorf("search balance %f, want about 58", balance)
+	}
+}
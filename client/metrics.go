@@ -0,0 +1,152 @@
+package client
+
+import "fmt"
+import "net/http"
+import "net/url"
+import "strings"
+import "time"
+
+import "github.com/firestuff/automana/metrics"
+
+type clientMetrics struct {
+	reg  *metrics.Registry
+	name string
+
+	requests         *metrics.CounterVec
+	latency          *metrics.HistogramVec
+	retries          *metrics.CounterVec
+	rateLimit        *metrics.GaugeVec
+	rateLimitRate    *metrics.GaugeVec
+	rateLimitSearch  *metrics.GaugeVec
+	concurrencyInUse *metrics.GaugeVec
+}
+
+// SetMetrics records request and limiter metrics into reg, labelled
+// client=name so several clients can share a registry. Metrics are off by
+// default. Calling it again replaces the registry and name.
+func (c *Client) SetMetrics(reg *metrics.Registry, name string) {
+	m := &clientMetrics{
+		reg:              reg,
+		name:             name,
+		requests:         reg.Counter("automana_client_requests_total", "API requests sent, by endpoint and status code (or \"error\" if no response was received)", "client", "method", "endpoint", "code"),
+		latency:          reg.Histogram("automana_client_request_duration_seconds", "API request latency", metrics.DefaultBuckets, "client", "method", "endpoint"),
+		retries:          reg.Counter("automana_client_retries_total", "API requests retried", "client", "method", "endpoint"),
+		rateLimit:        reg.Gauge("automana_client_rate_limit_balance", "Requests available from the client rate limit", "client"),
+		rateLimitRate:    reg.Gauge("automana_client_rate_limit_per_second", "Current adaptive refill rate of the client rate limit", "client"),
+		rateLimitSearch:  reg.Gauge("automana_client_search_rate_limit_balance", "Searches available from the per-workspace search rate limit", "client", "workspace"),
+		concurrencyInUse: reg.Gauge("automana_client_concurrency_in_use", "Concurrency limit slots in use", "client", "kind"),
+	}
+
+	c.metricsMu.Lock()
+	defer c.metricsMu.Unlock()
+
+	c.metrics = m
+
+	// Registries keep collectors forever, so add one per registry, not per
+	// call
+	if c.metricsRegistries == nil {
+		c.metricsRegistries = map[*metrics.Registry]bool{}
+	}
+
+	if !c.metricsRegistries[reg] {
+		c.metricsRegistries[reg] = true
+		reg.OnCollect(func() {
+			c.collectMetrics(reg)
+		})
+	}
+}
+
+func (c *Client) getMetrics() *clientMetrics {
+	c.metricsMu.Lock()
+	defer c.metricsMu.Unlock()
+
+	return c.metrics
+}
+
+// collectMetrics updates limiter gauges in reg, if it is still our registry
+func (c *Client) collectMetrics(reg *metrics.Registry) {
+	m := c.getMetrics()
+	if m == nil || m.reg != reg {
+		return
+	}
+
+	limits := c.getLimits()
+	rateLimit := limits.general()
+
+	m.rateLimit.Set(rateLimit.Balance(), m.name)
+	m.rateLimitRate.Set(rateLimit.PerSecond(), m.name)
+	m.concurrencyInUse.Set(float64(limits.concurrencyLimitRead.InUse()), m.name, "read")
+	m.concurrencyInUse.Set(float64(limits.concurrencyLimitWrite.InUse()), m.name, "write")
+
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+
+	for gid, rl := range limits.rateLimitSearch {
+		m.rateLimitSearch.Set(rl.Balance(), m.name, gid)
+	}
+}
+
+func (c *Client) observeRequest(method, endpoint string, start time.Time, resp *http.Response, err error) {
+	m := c.getMetrics()
+	if m == nil {
+		return
+	}
+
+	code := "error"
+	if err == nil {
+		code = fmt.Sprintf("%d", resp.StatusCode)
+	}
+
+	m.requests.Inc(m.name, method, endpoint, code)
+	m.latency.Observe(time.Since(start).Seconds(), m.name, method, endpoint)
+}
+
+func (c *Client) observeRetry(method, endpoint string) {
+	m := c.getMetrics()
+	if m == nil {
+		return
+	}
+
+	m.retries.Inc(m.name, method, endpoint)
+}
+
+// endpointOf turns a request URL into a low-cardinality label, e.g.
+// "tasks/{gid}/addTag"
+func (c *Client) endpointOf(rawURL string) string {
+	path := strings.TrimPrefix(rawURL, c.baseURL)
+
+	u, err := url.Parse(path)
+	if err == nil {
+		path = u.Path
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, part := range parts {
+		if isGIDLike(part) {
+			parts[i] = "{gid}"
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// isGIDLike matches path segments that identify an object: numeric GIDs,
+// email addresses and "me"
+func isGIDLike(part string) bool {
+	if part == "me" || strings.Contains(part, "@") {
+		return true
+	}
+
+	if part == "" {
+		return false
+	}
+
+	for _, r := range part {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,83 @@
+package client_test
+
+import "bytes"
+import "context"
+import "strings"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+import "github.com/firestuff/automana/metrics"
+
+// scrape returns each sample in reg's text exposition, keyed by name and
+// labels
+func scrape(t *testing.T, reg *metrics.Registry) map[string]string {
+	buf := &bytes.Buffer{}
+
+	err := reg.WriteText(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := map[string]string{}
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.LastIndex(line, " ")
+		samples[line[:i]] = line[i+1:]
+	}
+
+	return samples
+}
+
+func TestMetricsPerClient(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	s.AddWorkspace("Work")
+
+	reg := metrics.NewRegistry()
+	ctx := context.Background()
+
+	first := s.Client()
+	first.SetRateLimit(client.NewRateLimit(1, 10))
+	first.SetMetrics(reg, "old")
+	scrape(t, reg)
+
+	// Renamed, and set again as a restarted setup would
+	first.SetMetrics(reg, "first")
+	first.SetMetrics(reg, "first")
+
+	second := s.Client()
+	second.SetRateLimit(client.NewRateLimit(2, 20))
+	second.SetMetrics(reg, "second")
+
+	_, err := first.GetWorkspaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := scrape(t, reg)
+
+	tests := []struct {
+		sample string
+		want   string
+	}{
+		{`automana_client_requests_total{client="first",method="GET",endpoint="workspaces",code="200"}`, "1"},
+		{`automana_client_requests_total{client="second",method="GET",endpoint="workspaces",code="200"}`, ""},
+		{`automana_client_requests_total{client="old",method="GET",endpoint="workspaces",code="200"}`, ""},
+		{`automana_client_rate_limit_per_second{client="first"}`, "1"},
+		{`automana_client_rate_limit_per_second{client="second"}`, "2"},
+		{`automana_client_concurrency_in_use{client="first",kind="read"}`, "0"},
+		{`automana_client_concurrency_in_use{client="second",kind="write"}`, "0"},
+	}
+
+	for _, test := range tests {
+		if got := samples[test.sample]; got != test.want {
+			t.Errorf("%s = %q, want %q", test.sample, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package client
+
+import "context"
+import "crypto/rand"
+import "encoding/hex"
+import "encoding/json"
+import "fmt"
+import "io/ioutil"
+import "net"
+import "net/http"
+import "net/url"
+import "os"
+import "path/filepath"
+import "strings"
+import "sync"
+import "time"
+
+const defaultAuthURL = "https://app.asana.com/-/oauth_authorize"
+const defaultTokenURL = "https://app.asana.com/-/oauth_token"
+
+// Refresh this long before the token actually expires
+const oauthExpiryMargin = 1 * time.Minute
+
+// Refreshes block requests, so don't let a stuck token endpoint hang them
+const oauthTimeout = 30 * time.Second
+
+// OAuthConfig describes an Asana OAuth app. AuthURL and TokenURL default to
+// Asana's, and can be pointed elsewhere for testing. HTTPClient calls
+// TokenURL; if nil, a client with a timeout is used.
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthURL      string
+	TokenURL     string
+	HTTPClient   *http.Client
+}
+
+type OAuthToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// OAuthTokenStore persists the token between runs
+type OAuthTokenStore interface {
+	// Load returns nil if there is no stored token
+	Load() (*OAuthToken, error)
+	Save(*OAuthToken) error
+}
+
+type memoryOAuthTokenStore struct {
+	mu    sync.Mutex
+	token *OAuthToken
+}
+
+type fileOAuthTokenStore struct {
+	path string
+}
+
+type oauthTokenSource struct {
+	config *OAuthConfig
+	store  OAuthTokenStore
+
+	mu    sync.Mutex
+	token *OAuthToken
+}
+
+type oauthTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func NewOAuthConfig(clientID, clientSecret, redirectURL string) *OAuthConfig {
+	return &OAuthConfig{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      defaultAuthURL,
+		TokenURL:     defaultTokenURL,
+		HTTPClient: &http.Client{
+			Timeout: oauthTimeout,
+		},
+	}
+}
+
+// NewOAuthConfigFromEnv reads ASANA_CLIENT_ID, ASANA_CLIENT_SECRET and
+// ASANA_REDIRECT_URL
+func NewOAuthConfigFromEnv() *OAuthConfig {
+	return NewOAuthConfig(os.Getenv("ASANA_CLIENT_ID"), os.Getenv("ASANA_CLIENT_SECRET"), os.Getenv("ASANA_REDIRECT_URL"))
+}
+
+// AuthCodeURL is where to send the user to grant access; Asana redirects
+// back to RedirectURL with code and state parameters
+func (oc *OAuthConfig) AuthCodeURL(state string) string {
+	values := &url.Values{}
+	values.Set("client_id", oc.ClientID)
+	values.Set("redirect_uri", oc.RedirectURL)
+	values.Set("response_type", "code")
+	values.Set("state", state)
+
+	return fmt.Sprintf("%s?%s", oc.AuthURL, values.Encode())
+}
+
+// Exchange trades an authorization code for a token
+func (oc *OAuthConfig) Exchange(ctx context.Context, code string) (*OAuthToken, error) {
+	values := &url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", oc.RedirectURL)
+
+	return oc.requestToken(ctx, values, "")
+}
+
+// Refresh gets a new access token. The result keeps refreshToken unless
+// the server issues a new one.
+func (oc *OAuthConfig) Refresh(ctx context.Context, refreshToken string) (*OAuthToken, error) {
+	values := &url.Values{}
+	values.Set("grant_type", "refresh_token")
+	values.Set("refresh_token", refreshToken)
+	values.Set("redirect_uri", oc.RedirectURL)
+
+	return oc.requestToken(ctx, values, refreshToken)
+}
+
+// AuthorizeInteractive runs the authorization-code flow for a first login:
+// it prints AuthCodeURL, listens on RedirectURL's host for the redirect,
+// exchanges the code and saves the token to store.
+func (oc *OAuthConfig) AuthorizeInteractive(ctx context.Context, store OAuthTokenStore) (*OAuthToken, error) {
+	redirect, err := url.Parse(oc.RedirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != redirect.Path {
+				http.NotFound(w, r)
+				return
+			}
+
+			q := r.URL.Query()
+
+			if q.Get("state") != state {
+				http.Error(w, "state mismatch", http.StatusBadRequest)
+				return
+			}
+
+			if q.Get("error") != "" {
+				http.Error(w, q.Get("error"), http.StatusBadRequest)
+				errs <- fmt.Errorf("authorization failed: %s", q.Get("error"))
+				return
+			}
+
+			fmt.Fprintf(w, "Authorized; you can close this window.\n")
+			codes <- q.Get("code")
+		}),
+	}
+
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	fmt.Printf("Visit this URL to authorize:\n%s\n", oc.AuthCodeURL(state))
+
+	var code string
+
+	select {
+	case code = <-codes:
+	case err = <-errs:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	token, err := oc.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.Save(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (oc *OAuthConfig) requestToken(ctx context.Context, values *url.Values, refreshToken string) (*OAuthToken, error) {
+	values.Set("client_id", oc.ClientID)
+	values.Set("client_secret", oc.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", oc.TokenURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	httpClient := oc.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Timeout: oauthTimeout,
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body := &oauthTokenResponse{}
+
+	err = json.NewDecoder(resp.Body).Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("token endpoint: %s: %s", resp.Status, err)
+	}
+
+	if !isSuccess(resp) || body.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s: %s", resp.Status, strings.TrimSpace(fmt.Sprintf("%s %s", body.Error, body.ErrorDescription)))
+	}
+
+	token := &OAuthToken{
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+	}
+
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+
+	return token, nil
+}
+
+// NewOAuthTokenSource refreshes the token from store whenever it is about
+// to expire or is rejected, saving each new token back to store
+func NewOAuthTokenSource(config *OAuthConfig, store OAuthTokenStore) TokenSource {
+	return &oauthTokenSource{
+		config: config,
+		store:  store,
+	}
+}
+
+func (s *oauthTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil {
+		token, err := s.store.Load()
+		if err != nil {
+			return "", err
+		}
+
+		if token == nil {
+			return "", fmt.Errorf("No OAuth token stored; authorize first")
+		}
+
+		s.token = token
+	}
+
+	if time.Now().Add(oauthExpiryMargin).Before(s.token.Expiry) {
+		return s.token.AccessToken, nil
+	}
+
+	token, err := s.config.Refresh(ctx, s.token.RefreshToken)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.store.Save(token)
+	if err != nil {
+		return "", err
+	}
+
+	s.token = token
+
+	return s.token.AccessToken, nil
+}
+
+func (s *oauthTokenSource) Invalidate(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil || s.token.RefreshToken == "" {
+		return false
+	}
+
+	if s.token.AccessToken == token {
+		// Force a refresh on the next Token
+		s.token.Expiry = time.Time{}
+	}
+
+	return true
+}
+
+func NewMemoryOAuthTokenStore(token *OAuthToken) OAuthTokenStore {
+	return &memoryOAuthTokenStore{
+		token: token,
+	}
+}
+
+// NewFileOAuthTokenStore keeps the token as JSON in path, readable only by
+// the owner
+func NewFileOAuthTokenStore(path string) OAuthTokenStore {
+	return &fileOAuthTokenStore{
+		path: path,
+	}
+}
+
+func (s *memoryOAuthTokenStore) Load() (*OAuthToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil {
+		return nil, nil
+	}
+
+	token := *s.token
+	return &token, nil
+}
+
+func (s *memoryOAuthTokenStore) Save(token *OAuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *token
+	s.token = &saved
+	return nil
+}
+
+func (s *fileOAuthTokenStore) Load() (*OAuthToken, error) {
+	buf, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := &OAuthToken{}
+
+	err = json.Unmarshal(buf, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *fileOAuthTokenStore) Save(token *OAuthToken) error {
+	buf, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so a crash can't leave a truncated token
+	tmp := fmt.Sprintf("%s.tmp", s.path)
+
+	err = ioutil.WriteFile(tmp, buf, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
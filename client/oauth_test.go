@@ -0,0 +1,165 @@
+package client_test
+
+import "context"
+import "testing"
+import "time"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestOAuthExchange(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	oc := s.OAuthConfig("http://localhost/callback")
+	ctx := context.Background()
+
+	code := s.AuthCode()
+
+	token, err := oc.Exchange(ctx, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != s.Token {
+		t.Errorf("access token %s, want %s", token.AccessToken, s.Token)
+	}
+
+	if token.RefreshToken == "" {
+		t.Error("no refresh token")
+	}
+
+	if token.Expiry.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("expiry %s, want about an hour from now", token.Expiry)
+	}
+
+	_, err = oc.Exchange(ctx, code)
+	if err == nil {
+		t.Error("reused code accepted")
+	}
+
+	refreshed, err := oc.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refreshed.AccessToken == token.AccessToken {
+		t.Error("refresh returned the same access token")
+	}
+
+	if refreshed.RefreshToken != token.RefreshToken {
+		t.Errorf("refresh token %s, want %s kept", refreshed.RefreshToken, token.RefreshToken)
+	}
+}
+
+func TestOAuthRefreshOnExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		lifetime  time.Duration
+		requests  int
+		refreshes int
+	}{
+		{"long lived", time.Hour, 3, 0},
+		{"within expiry margin", 30 * time.Second, 3, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			s.AddWorkspace("Work")
+			s.SetTokenLifetime(test.lifetime)
+
+			oc := s.OAuthConfig("http://localhost/callback")
+			ctx := context.Background()
+
+			token, err := oc.Exchange(ctx, s.AuthCode())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			store := client.NewMemoryOAuthTokenStore(token)
+
+			c := client.NewClientWithTokenSource(client.NewOAuthTokenSource(oc, store), s.URL())
+			c.SetCacheTTL(client.NewNoCacheTTL())
+
+			for i := 0; i < test.requests; i++ {
+				_, err = c.GetWorkspaces(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// One for the exchange
+			refreshes := countRequests(s, "POST /-/oauth_token") - 1
+			if refreshes != test.refreshes {
+				t.Errorf("%d refreshes, want %d", refreshes, test.refreshes)
+			}
+
+			stored, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.AccessToken != s.Token {
+				t.Errorf("stored token %s, want %s", stored.AccessToken, s.Token)
+			}
+		})
+	}
+}
+
+func TestOAuthRetryAfterUnauthorized(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	s.AddWorkspace("Work")
+
+	oc := s.OAuthConfig("http://localhost/callback")
+	ctx := context.Background()
+
+	token, err := oc.Exchange(ctx, s.AuthCode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := client.NewClientWithTokenSource(client.NewOAuthTokenSource(oc, client.NewMemoryOAuthTokenStore(token)), s.URL())
+	c.SetCacheTTL(client.NewNoCacheTTL())
+
+	_, err = c.GetWorkspaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RevokeToken()
+
+	_, err = c.GetWorkspaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := countRequests(s, "GET /workspaces"); got != 3 {
+		t.Errorf("%d workspace requests, want 3", got)
+	}
+
+	if got := countRequests(s, "POST /-/oauth_token"); got != 2 {
+		t.Errorf("%d token requests, want 2", got)
+	}
+
+	// A static token can't be refreshed, so the 401 is returned
+	s.RevokeToken()
+
+	static := client.NewClientWithBaseURL(token.AccessToken, s.URL())
+	static.SetCacheTTL(client.NewNoCacheTTL())
+
+	before := countRequests(s, "GET /workspaces")
+
+	_, err = static.GetWorkspaces(ctx)
+	if err == nil {
+		t.Error("revoked static token accepted")
+	}
+
+	if got := countRequests(s, "GET /workspaces") - before; got != 1 {
+		t.Errorf("%d workspace requests with a static token, want 1", got)
+	}
+}
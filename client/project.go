@@ -1,5 +1,7 @@
 package client
 
+import "context"
+import "errors"
 import "fmt"
 import "net/url"
 
@@ -8,6 +10,10 @@ type Project struct {
 	Name string `json:"name"`
 }
 
+type taskProjectData struct {
+	Project string `json:"project"`
+}
+
 type projectResponse struct {
 	Data *Project `json:"data"`
 }
@@ -17,15 +23,28 @@ type projectsResponse struct {
 	NextPage *nextPage  `json:"next_page"`
 }
 
-func (wc *WorkspaceClient) GetProjects() ([]*Project, error) {
+func (wc *WorkspaceClient) GetProjects(ctx context.Context) ([]*Project, error) {
+	path := fmt.Sprintf("workspaces/%s/projects", wc.workspace.GID)
+
+	cache := wc.client.cache
+	projects, err := cache.getOrFetch(ctx, path, cache.ttls().Projects, func() (interface{}, error) {
+		return wc.fetchProjects(ctx, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return projects.([]*Project), nil
+}
+
+func (wc *WorkspaceClient) fetchProjects(ctx context.Context, path string) ([]*Project, error) {
 	ret := []*Project{}
 
-	path := fmt.Sprintf("workspaces/%s/projects", wc.workspace.GID)
 	values := &url.Values{}
 
 	for {
 		resp := &projectsResponse{}
-		err := wc.client.get(path, values, resp)
+		err := wc.client.get(ctx, path, values, resp)
 		if err != nil {
 			return nil, err
 		}
@@ -45,3 +64,50 @@ func (wc *WorkspaceClient) GetProjects() ([]*Project, error) {
 func (p *Project) String() string {
 	return fmt.Sprintf("%s (%s)", p.GID, p.Name)
 }
+
+func (wc *WorkspaceClient) GetProjectsByName(ctx context.Context) (map[string]*Project, error) {
+	projects, err := wc.GetProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	projectsByName := map[string]*Project{}
+	for _, project := range projects {
+		projectsByName[project.Name] = project
+	}
+
+	return projectsByName, err
+}
+
+func (wc *WorkspaceClient) InvalidateProjects() {
+	wc.client.cache.invalidate(fmt.Sprintf("workspaces/%s/projects", wc.workspace.GID))
+}
+
+// AddProject adds task to project, in the project's default section. Use
+// AddTaskToSection to pick the section.
+func (wc *WorkspaceClient) AddProject(ctx context.Context, task *Task, project *Project) error {
+	return wc.changeProject(ctx, task, "addProject", project)
+}
+
+func (wc *WorkspaceClient) RemoveProject(ctx context.Context, task *Task, project *Project) error {
+	return wc.changeProject(ctx, task, "removeProject", project)
+}
+
+func (wc *WorkspaceClient) changeProject(ctx context.Context, task *Task, action string, project *Project) error {
+	err := wc.postTaskAction(ctx, task, action, &taskProjectData{
+		Project: project.GID,
+	})
+	if err != nil {
+		wc.projectNotFound(err)
+		return err
+	}
+
+	return nil
+}
+
+func (wc *WorkspaceClient) projectNotFound(err error) {
+	if errors.Is(err, ErrNotFound) {
+		// Could be the task, but could be a deleted project
+		wc.InvalidateProjects()
+	}
+}
@@ -0,0 +1,104 @@
+package client_test
+
+import "context"
+import "errors"
+import "fmt"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestProjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		member  bool
+		remove  bool
+		unknown bool
+		want    bool
+		wantErr error
+	}{
+		{"add", false, false, false, true, nil},
+		{"add again", true, false, false, true, nil},
+		{"remove", true, true, false, false, nil},
+		{"remove absent", false, true, false, false, nil},
+		{"add unknown", false, false, true, false, client.ErrNotFound},
+		{"remove unknown", true, true, true, true, client.ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			proj := s.AddProject(wrk, "Project")
+			sec := s.AddSection(proj, "Section")
+
+			ctx := context.Background()
+
+			wc, err := s.Client().InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			projects, err := wc.GetProjectsByName(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if projects["Project"] == nil {
+				t.Fatalf("Project missing from %v", projects)
+			}
+
+			task := &asanatest.Task{Name: "Task"}
+			if test.member {
+				task.Sections = []*client.Section{sec}
+			}
+			gid := s.AddTask(wrk, task)
+
+			target := projects["Project"]
+			if test.unknown {
+				target = &client.Project{GID: "404"}
+			}
+
+			if test.remove {
+				err = wc.RemoveProject(ctx, &client.Task{GID: gid}, target)
+			} else {
+				err = wc.AddProject(ctx, &client.Task{GID: gid}, target)
+			}
+
+			if test.wantErr == nil && err != nil {
+				t.Fatal(err)
+			}
+
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("err %v, want %v", err, test.wantErr)
+			}
+
+			got := s.GetTask(gid).Sections
+			if len(got) > 1 {
+				t.Errorf("in sections %v, want at most one", got)
+			}
+
+			member := len(got) == 1 && got[0].GID == sec.GID
+			if member != test.want {
+				t.Errorf("in project %t, want %t", member, test.want)
+			}
+
+			// A missing project may have been deleted, so the list is
+			// refetched
+			list := fmt.Sprintf("GET /workspaces/%s/projects", wrk.GID)
+			before := countRequests(s, list)
+
+			_, err = wc.GetProjects(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			refetched := countRequests(s, list) > before
+			if refetched != test.unknown {
+				t.Errorf("projects refetched %t, want %t", refetched, test.unknown)
+			}
+		})
+	}
+}
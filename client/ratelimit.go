@@ -1,24 +1,56 @@
 package client
 
+import "context"
 import "net/http"
-import "strconv"
 import "sync"
 import "time"
 
+// RateLimit is a token bucket whose refill rate adapts to server feedback:
+// it halves on 429 responses and creeps back up to its configured rate on
+// success (AIMD). Request costs depend on their CostClass.
 type RateLimit struct {
-	perSecond float64
-	balance   float64
-	limit     float64
-	updated   time.Time
-	mu        sync.Mutex
+	perSecond    float64
+	maxPerSecond float64
+	minPerSecond float64
+	balance      float64
+	limit        float64
+	costs        map[CostClass]float64
+	updated      time.Time
+	lastDecrease time.Time
+	mu           sync.Mutex
 }
 
+type CostClass int
+
+const (
+	CostRead CostClass = iota
+	CostWrite
+	CostSearch
+)
+
+// Never back off below this fraction of the configured rate
+const minRateFraction = 0.05
+
+// Fraction of the configured rate recovered per successful request
+const rateIncreaseFraction = 0.01
+
+// Multiple in-flight requests usually fail together; treat 429s this close
+// together as a single signal
+const rateDecreaseInterval = 1 * time.Second
+
 func NewRateLimit(perSecond, limit float64) *RateLimit {
 	return &RateLimit{
-		perSecond: perSecond,
-		balance:   limit,
-		limit:     limit,
-		updated:   time.Now(),
+		perSecond:    perSecond,
+		maxPerSecond: perSecond,
+		minPerSecond: perSecond * minRateFraction,
+		balance:      limit,
+		limit:        limit,
+		costs: map[CostClass]float64{
+			CostRead:   1,
+			CostWrite:  1,
+			CostSearch: 1,
+		},
+		updated: time.Now(),
 	}
 }
 
@@ -26,51 +58,145 @@ func NewRateLimitPerMinute(perMinute, limit float64) *RateLimit {
 	return NewRateLimit(perMinute/60, limit)
 }
 
+// SetCost changes the quota consumed by each request of class. Costs above
+// the bucket's limit are charged as the limit, since more can never accrue.
+func (rl *RateLimit) SetCost(class CostClass, cost float64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.costs[class] = cost
+}
+
+// Acquire sufficient rate quota to execute 1 operation of class
+func (rl *RateLimit) Acquire(ctx context.Context, class CostClass) error {
+	rl.mu.Lock()
+	cost := rl.costs[class]
+	rl.mu.Unlock()
+
+	return rl.AcquireN(ctx, cost)
+}
+
 // Acquire sufficient rate quota to execute 1 operation
-func (rl *RateLimit) Acquire1() {
-	rl.AcquireN(1.0)
+func (rl *RateLimit) Acquire1(ctx context.Context) error {
+	return rl.AcquireN(ctx, 1.0)
 }
 
-// Acquire sufficient rate quota to execute /cost/ operations
-func (rl *RateLimit) AcquireN(cost float64) {
+// Acquire sufficient rate quota to execute /cost/ operations. A cost above
+// the limit is clamped to it; otherwise it could never be afforded.
+func (rl *RateLimit) AcquireN(ctx context.Context, cost float64) error {
 	for {
 		rl.mu.Lock()
 
+		if cost > rl.limit {
+			cost = rl.limit
+		}
+
 		rl.replenish()
 
 		if rl.balance >= cost {
 			rl.balance -= cost
 			rl.mu.Unlock()
-			return
+			return nil
 		}
 
+		// The rate may change while we sleep, so recalculate after
 		costDelta := cost - rl.balance
 		sleep := time.Duration(costDelta / rl.perSecond * float64(time.Second))
 		rl.mu.Unlock()
-		time.Sleep(sleep)
+
+		err := sleepContext(ctx, sleep)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Balance is the quota currently available; negative while backing off
+func (rl *RateLimit) Balance() float64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.replenish()
+
+	return rl.balance
+}
+
+// PerSecond is the current, possibly reduced, refill rate
+func (rl *RateLimit) PerSecond() float64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return rl.perSecond
+}
+
+// Observe adapts the rate to a response: 429s slow it down, successes
+// speed it back up, and any Retry-After pauses it
+func (rl *RateLimit) Observe(resp *http.Response) {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		rl.Throttled()
+	case isSuccess(resp):
+		rl.Succeeded()
+	}
+
+	rl.MaybeRetryAfter(resp)
+}
+
+// Throttled multiplicatively decreases the rate
+func (rl *RateLimit) Throttled() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.lastDecrease) < rateDecreaseInterval {
+		return
+	}
+
+	rl.replenish()
+
+	rl.perSecond /= 2
+	if rl.perSecond < rl.minPerSecond {
+		rl.perSecond = rl.minPerSecond
 	}
+
+	rl.lastDecrease = now
 }
 
-func (rl *RateLimit) MaybeRetryAfter(resp *http.Response) error {
-	header := resp.Header.Get("Retry-After")
-	if header == "" {
-		return nil
+// Succeeded additively increases the rate, up to the configured rate
+func (rl *RateLimit) Succeeded() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.perSecond >= rl.maxPerSecond {
+		return
+	}
+
+	rl.replenish()
+
+	rl.perSecond += rl.maxPerSecond * rateIncreaseFraction
+	if rl.perSecond > rl.maxPerSecond {
+		rl.perSecond = rl.maxPerSecond
 	}
+}
 
-	retryAfter, err := strconv.ParseInt(header, 10, 64)
-	if err != nil {
-		return err
+func (rl *RateLimit) MaybeRetryAfter(resp *http.Response) {
+	retryAfter, found := parseRetryAfter(resp, time.Now())
+	if !found {
+		return
 	}
 
 	rl.RetryAfter(retryAfter)
-	return nil
 }
 
-func (rl *RateLimit) RetryAfter(seconds int64) {
+// RetryAfter drives the balance negative so that the next operation waits
+// at least d
+func (rl *RateLimit) RetryAfter(d time.Duration) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	target := 1.0 - (float64(seconds) * rl.perSecond)
+	rl.replenish()
+
+	target := 1.0 - (d.Seconds() * rl.perSecond)
 	if target < rl.balance {
 		rl.balance = target
 	}
@@ -0,0 +1,89 @@
+package client
+
+import "context"
+import "errors"
+import "math"
+import "net/http"
+import "testing"
+import "time"
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 0.001
+}
+
+func TestRateLimitAIMD(t *testing.T) {
+	rl := NewRateLimit(100, 10)
+
+	rl.Throttled()
+	if !approx(rl.PerSecond(), 50) {
+		t.Fatalf("after 429: %f/s, want 50", rl.PerSecond())
+	}
+
+	// Counted as the same signal
+	rl.Throttled()
+	if !approx(rl.PerSecond(), 50) {
+		t.Fatalf("after second 429: %f/s, want 50", rl.PerSecond())
+	}
+
+	for i := 0; i < 10; i++ {
+		rl.lastDecrease = time.Time{}
+		rl.Throttled()
+	}
+
+	if !approx(rl.PerSecond(), 100*minRateFraction) {
+		t.Fatalf("after many 429s: %f/s, want the %f floor", rl.PerSecond(), 100*minRateFraction)
+	}
+
+	rl.Succeeded()
+	if !approx(rl.PerSecond(), 100*minRateFraction+100*rateIncreaseFraction) {
+		t.Fatalf("after success: %f/s", rl.PerSecond())
+	}
+
+	for i := 0; i < 200; i++ {
+		rl.Succeeded()
+	}
+
+	if !approx(rl.PerSecond(), 100) {
+		t.Fatalf("after many successes: %f/s, want 100", rl.PerSecond())
+	}
+}
+
+func TestRateLimitObserve(t *testing.T) {
+	rl := NewRateLimit(10, 10)
+
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{},
+	}
+	resp.Header.Set("Retry-After", "2")
+
+	rl.Observe(resp)
+
+	if !approx(rl.PerSecond(), 5) {
+		t.Errorf("%f/s, want 5", rl.PerSecond())
+	}
+
+	// Enough debt to wait out Retry-After at the reduced rate
+	if rl.Balance() > 1-2*5+0.1 {
+		t.Errorf("balance %f, want about %f", rl.Balance(), 1.0-2*5)
+	}
+}
+
+func TestRateLimitAcquireCanceled(t *testing.T) {
+	rl := NewRateLimit(1, 1)
+	rl.RetryAfter(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	err := rl.Acquire(ctx, CostRead)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("Acquire returned after %s", time.Since(start))
+	}
+}
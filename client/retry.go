@@ -0,0 +1,135 @@
+package client
+
+import "context"
+import "math/rand"
+import "net/http"
+import "strconv"
+import "time"
+
+type RetryPolicy struct {
+	// Total attempts, including the first
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+func NewRetryPolicy(maxAttempts int, minBackoff, maxBackoff time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		MinBackoff:  minBackoff,
+		MaxBackoff:  maxBackoff,
+	}
+}
+
+func NewDefaultRetryPolicy() *RetryPolicy {
+	return NewRetryPolicy(5, 1*time.Second, 60*time.Second)
+}
+
+// Never retry
+func NewNoRetryPolicy() *RetryPolicy {
+	return NewRetryPolicy(1, 0, 0)
+}
+
+// Methods that can be safely repeated even if the first attempt may have
+// been processed by the server
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+// shouldRetry decides whether to retry after attempt number /attempt/
+// (1-based) returned resp or err.
+func (rp *RetryPolicy) shouldRetry(method string, attempt int, resp *http.Response, err error) bool {
+	if attempt >= rp.MaxAttempts {
+		return false
+	}
+
+	if err != nil {
+		// The request may have reached the server
+		return idempotentMethods[method]
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// Asana rejects throttled requests before processing them
+		return true
+
+	case resp.StatusCode >= 500:
+		return idempotentMethods[method]
+
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay before attempt number /attempt/+1, using
+// exponential backoff with jitter, but no less than any Retry-After
+// requested by the server. A zero MinBackoff retries immediately.
+func (rp *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	d := time.Duration(0)
+	if rp.MinBackoff > 0 {
+		d = rp.MaxBackoff
+		if attempt < 32 {
+			exp := rp.MinBackoff * time.Duration(1<<uint(attempt-1))
+			if exp > 0 && exp < rp.MaxBackoff {
+				d = exp
+			}
+		}
+	}
+
+	if d > 0 {
+		// Jitter in [d/2, d)
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+
+	if resp != nil {
+		retryAfter, found := parseRetryAfter(resp, time.Now())
+		if found && retryAfter > d {
+			d = retryAfter
+		}
+	}
+
+	return d
+}
+
+// parseRetryAfter accepts both delay-seconds and HTTP-date forms
+func parseRetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	secs, err := strconv.ParseInt(header, 10, 64)
+	if err == nil {
+		if secs < 0 {
+			secs = 0
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	t, err := http.ParseTime(header)
+	if err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package client_test
+
+import "context"
+import "errors"
+import "fmt"
+import "testing"
+import "time"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		post     bool
+		failures int
+		status   int
+		requests int
+		wantErr  error
+	}{
+		{"GET recovers from 500s", false, 2, 500, 3, nil},
+		{"GET gives up after MaxAttempts", false, 5, 500, 3, client.ErrServer},
+		{"POST isn't retried on 500", true, 1, 500, 1, client.ErrServer},
+		{"POST is retried on 429", true, 1, 429, 2, nil},
+		{"GET gives up on 429s", false, 5, 429, 3, client.ErrRateLimited},
+		{"GET isn't retried on 404", false, 1, 404, 1, client.ErrNotFound},
+		{"GET isn't retried on 403", false, 1, 403, 1, client.ErrForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			tag := s.AddTag(wrk, "Tag")
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+
+			c := s.Client()
+			c.SetRetryPolicy(client.NewRetryPolicy(3, time.Millisecond, 10*time.Millisecond))
+			c.SetRateLimit(client.NewRateLimit(1000, 1000))
+
+			ctx := context.Background()
+
+			wc, err := c.InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s.FailNext(test.failures, test.status, "")
+
+			req := fmt.Sprintf("GET /tasks/%s", gid)
+			if test.post {
+				req = fmt.Sprintf("POST /tasks/%s/addTag", gid)
+				err = wc.AddTag(ctx, &client.Task{GID: gid}, tag)
+			} else {
+				_, err = wc.GetTask(ctx, gid)
+			}
+
+			if test.wantErr == nil && err != nil {
+				t.Fatal(err)
+			}
+
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("err %v, want %v", err, test.wantErr)
+			}
+
+			got := countRequests(s, req)
+			if got != test.requests {
+				t.Errorf("%d requests, want %d: %v", got, test.requests, s.Requests())
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	s.AddWorkspace("Work")
+
+	c := s.Client()
+	c.SetRetryPolicy(client.NewRetryPolicy(3, time.Millisecond, 10*time.Millisecond))
+
+	s.FailNext(1, 429, "1")
+
+	start := time.Now()
+
+	_, err := c.GetWorkspaces(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the 1s Retry-After", elapsed)
+	}
+}
+
+func TestRetryWithoutBackoff(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	s.AddWorkspace("Work")
+
+	c := s.Client()
+	c.SetRetryPolicy(client.NewRetryPolicy(3, 0, 10*time.Second))
+
+	s.FailNext(2, 500, "")
+
+	start := time.Now()
+
+	_, err := c.GetWorkspaces(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elapsed := time.Since(start)
+	if elapsed > time.Second {
+		t.Errorf("retried after %s, want no backoff", elapsed)
+	}
+}
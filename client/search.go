@@ -1,21 +1,65 @@
 package client
 
+import "context"
 import "fmt"
 import "net/url"
 import "strings"
+import "time"
 
 import "cloud.google.com/go/civil"
 
 type SearchQuery struct {
-	AssigneeAny []*User
-	SectionsAny []*Section
-	Completed   *bool
-	Due         *bool
-	DueOn       *civil.Date
-	DueBefore   *civil.Date
-	DueAfter    *civil.Date
-	TagsAny     []*Tag
-	TagsNot     []*Tag
+	Text            string
+	ResourceSubtype string
+
+	AssigneeAny  []*User
+	AssigneeNot  []*User
+	FollowersAny []*User
+	ProjectsAny  []*Project
+	ProjectsAll  []*Project
+	ProjectsNot  []*Project
+	SectionsAny  []*Section
+	SectionsAll  []*Section
+	SectionsNot  []*Section
+	TagsAny      []*Tag
+	TagsAll      []*Tag
+	TagsNot      []*Tag
+	TeamsAny     []*Team
+
+	Completed     *bool
+	IsBlocked     *bool
+	IsBlocking    *bool
+	HasAttachment *bool
+	// Defaults to false if unset
+	IsSubtask *bool
+
+	Due           *bool
+	DueOn         *civil.Date
+	DueBefore     *civil.Date
+	DueAfter      *civil.Date
+	DueAtBefore   *time.Time
+	DueAtAfter    *time.Time
+	StartOnBefore *civil.Date
+	StartOnAfter  *civil.Date
+
+	CreatedAtBefore   *time.Time
+	CreatedAtAfter    *time.Time
+	ModifiedAtBefore  *time.Time
+	ModifiedAtAfter   *time.Time
+	CompletedAtBefore *time.Time
+	CompletedAtAfter  *time.Time
+
+	CustomFields []*CustomFieldQuery
+}
+
+// CustomFieldQuery matches tasks on the value of one custom field. Set
+// only the predicates you want.
+type CustomFieldQuery struct {
+	GID         string
+	Value       *string
+	LessThan    *float64
+	GreaterThan *float64
+	IsSet       *bool
 }
 
 var _TRUE = true
@@ -23,35 +67,62 @@ var TRUE = &_TRUE
 var _FALSE = false
 var FALSE = &_FALSE
 
-func (wc *WorkspaceClient) Search(q *SearchQuery) ([]*Task, error) {
-	path := fmt.Sprintf("workspaces/%s/tasks/search", wc.workspace.GID)
+// Search returns all matching tasks, ordered by creation time
+func (wc *WorkspaceClient) Search(ctx context.Context, q *SearchQuery) ([]*Task, error) {
+	tasks := []*Task{}
+
+	it := wc.SearchIter(q, 0)
+	for it.Next(ctx) {
+		tasks = append(tasks, it.Task())
+	}
 
+	err := it.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+func (q *SearchQuery) values() *url.Values {
 	values := &url.Values{
-		"is_subtask":     []string{"false"},
 		"sort_by":        []string{"created_at"},
 		"sort_ascending": []string{"true"},
 	}
 
-	values.Add("opt_fields", "assignee_section,created_at,due_on,html_notes,name")
+	values.Add("opt_fields", taskOptFields)
 
-	if len(q.AssigneeAny) > 0 {
-		gids := []string{}
-		for _, u := range q.AssigneeAny {
-			gids = append(gids, u.GID)
-		}
-		values.Add("assignee.any", strings.Join(gids, ","))
+	if q.Text != "" {
+		values.Add("text", q.Text)
 	}
 
-	if len(q.SectionsAny) > 0 {
-		gids := []string{}
-		for _, sec := range q.SectionsAny {
-			gids = append(gids, sec.GID)
-		}
-		values.Add("sections.any", strings.Join(gids, ","))
+	if q.ResourceSubtype != "" {
+		values.Add("resource_subtype", q.ResourceSubtype)
 	}
 
-	if q.Completed != nil {
-		values.Add("completed", fmt.Sprintf("%t", *q.Completed))
+	addUsers(values, "assignee.any", q.AssigneeAny)
+	addUsers(values, "assignee.not", q.AssigneeNot)
+	addUsers(values, "followers.any", q.FollowersAny)
+	addProjects(values, "projects.any", q.ProjectsAny)
+	addProjects(values, "projects.all", q.ProjectsAll)
+	addProjects(values, "projects.not", q.ProjectsNot)
+	addSections(values, "sections.any", q.SectionsAny)
+	addSections(values, "sections.all", q.SectionsAll)
+	addSections(values, "sections.not", q.SectionsNot)
+	addTags(values, "tags.any", q.TagsAny)
+	addTags(values, "tags.all", q.TagsAll)
+	addTags(values, "tags.not", q.TagsNot)
+	addTeams(values, "teams.any", q.TeamsAny)
+
+	addBool(values, "completed", q.Completed)
+	addBool(values, "is_blocked", q.IsBlocked)
+	addBool(values, "is_blocking", q.IsBlocking)
+	addBool(values, "has_attachment", q.HasAttachment)
+
+	if q.IsSubtask != nil {
+		addBool(values, "is_subtask", q.IsSubtask)
+	} else {
+		addBool(values, "is_subtask", FALSE)
 	}
 
 	if q.Due != nil {
@@ -62,69 +133,102 @@ func (wc *WorkspaceClient) Search(q *SearchQuery) ([]*Task, error) {
 		}
 	}
 
-	if q.DueOn != nil {
-		values.Add("due_on", q.DueOn.String())
-	}
-
-	if q.DueBefore != nil {
-		values.Add("due_on.before", q.DueBefore.String())
-	}
-
-	if q.DueAfter != nil {
-		values.Add("due_on.after", q.DueAfter.String())
-	}
+	addDate(values, "due_on", q.DueOn)
+	addDate(values, "due_on.before", q.DueBefore)
+	addDate(values, "due_on.after", q.DueAfter)
+	addTime(values, "due_at.before", q.DueAtBefore)
+	addTime(values, "due_at.after", q.DueAtAfter)
+	addDate(values, "start_on.before", q.StartOnBefore)
+	addDate(values, "start_on.after", q.StartOnAfter)
+
+	addTime(values, "created_at.before", q.CreatedAtBefore)
+	addTime(values, "created_at.after", q.CreatedAtAfter)
+	addTime(values, "modified_at.before", q.ModifiedAtBefore)
+	addTime(values, "modified_at.after", q.ModifiedAtAfter)
+	addTime(values, "completed_at.before", q.CompletedAtBefore)
+	addTime(values, "completed_at.after", q.CompletedAtAfter)
+
+	for _, cf := range q.CustomFields {
+		prefix := fmt.Sprintf("custom_fields.%s", cf.GID)
+
+		if cf.Value != nil {
+			values.Add(fmt.Sprintf("%s.value", prefix), *cf.Value)
+		}
 
-	if len(q.TagsAny) > 0 {
-		gids := []string{}
-		for _, sec := range q.TagsAny {
-			gids = append(gids, sec.GID)
+		if cf.LessThan != nil {
+			values.Add(fmt.Sprintf("%s.less_than", prefix), fmt.Sprintf("%g", *cf.LessThan))
 		}
-		values.Add("tags.any", strings.Join(gids, ","))
-	}
 
-	if len(q.TagsNot) > 0 {
-		gids := []string{}
-		for _, sec := range q.TagsNot {
-			gids = append(gids, sec.GID)
+		if cf.GreaterThan != nil {
+			values.Add(fmt.Sprintf("%s.greater_than", prefix), fmt.Sprintf("%g", *cf.GreaterThan))
 		}
-		values.Add("tags.not", strings.Join(gids, ","))
+
+		addBool(values, fmt.Sprintf("%s.is_set", prefix), cf.IsSet)
 	}
 
-	tasksByGID := map[string]*Task{}
+	return values
+}
+
+func addUsers(values *url.Values, key string, users []*User) {
+	gids := []string{}
+	for _, u := range users {
+		gids = append(gids, u.GID)
+	}
+	addGIDs(values, key, gids)
+}
 
-	for {
-		resp := &tasksResponse{}
-		wc.rateLimitSearch.Acquire1()
-		err := wc.client.get(path, values, resp)
-		if err != nil {
-			return nil, err
-		}
+func addProjects(values *url.Values, key string, projects []*Project) {
+	gids := []string{}
+	for _, p := range projects {
+		gids = append(gids, p.GID)
+	}
+	addGIDs(values, key, gids)
+}
 
-		maxCreatedAt := ""
+func addSections(values *url.Values, key string, sections []*Section) {
+	gids := []string{}
+	for _, sec := range sections {
+		gids = append(gids, sec.GID)
+	}
+	addGIDs(values, key, gids)
+}
 
-		for _, task := range resp.Data {
-			err := task.parse()
-			if err != nil {
-				return nil, err
-			}
-			tasksByGID[task.GID] = task
+func addTags(values *url.Values, key string, tags []*Tag) {
+	gids := []string{}
+	for _, tag := range tags {
+		gids = append(gids, tag.GID)
+	}
+	addGIDs(values, key, gids)
+}
 
-			if task.CreatedAt > maxCreatedAt {
-				maxCreatedAt = task.CreatedAt
-			}
-		}
+func addTeams(values *url.Values, key string, teams []*Team) {
+	gids := []string{}
+	for _, team := range teams {
+		gids = append(gids, team.GID)
+	}
+	addGIDs(values, key, gids)
+}
 
-		if len(resp.Data) < perPage {
-			break
-		}
+func addGIDs(values *url.Values, key string, gids []string) {
+	if len(gids) > 0 {
+		values.Add(key, strings.Join(gids, ","))
+	}
+}
 
-		values.Set("created_at.after", maxCreatedAt)
+func addBool(values *url.Values, key string, b *bool) {
+	if b != nil {
+		values.Add(key, fmt.Sprintf("%t", *b))
 	}
+}
 
-	tasks := []*Task{}
-	for _, task := range tasksByGID {
-		tasks = append(tasks, task)
+func addDate(values *url.Values, key string, d *civil.Date) {
+	if d != nil {
+		values.Add(key, d.String())
 	}
+}
 
-	return tasks, nil
+func addTime(values *url.Values, key string, t *time.Time) {
+	if t != nil {
+		values.Add(key, t.UTC().Format(time.RFC3339))
+	}
 }
@@ -0,0 +1,78 @@
+package client_test
+
+import "context"
+import "errors"
+import "testing"
+import "time"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestSearchIterTies(t *testing.T) {
+	tests := []struct {
+		name       string
+		tasks      int
+		tieSize    int
+		maxResults int
+		want       int
+		wantErr    error
+	}{
+		{"no ties", 250, 1, 0, 250, nil},
+		{"ties across pages", 250, 7, 0, 250, nil},
+		{"ties ending on a page boundary", 250, 50, 0, 250, nil},
+		{"maxResults", 250, 7, 120, 120, nil},
+		{"more than a page of ties", 250, 150, 0, 100, client.ErrSearchTies},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+
+			base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+			gids := []string{}
+
+			for i := 0; i < test.tasks; i++ {
+				created := base.Add(time.Duration(i/test.tieSize) * time.Second)
+				gids = append(gids, s.AddTask(wrk, &asanatest.Task{
+					Name:      "Task",
+					CreatedAt: created.Format("2006-01-02T15:04:05.000Z"),
+				}))
+			}
+
+			c := s.Client()
+			c.SetRateLimit(client.NewRateLimit(1000, 1000))
+
+			ctx := context.Background()
+
+			wc, err := c.InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			it := wc.SearchIter(&client.SearchQuery{}, test.maxResults)
+
+			got := []string{}
+			for it.Next(ctx) {
+				got = append(got, it.Task().GID)
+			}
+
+			err = it.Err()
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err %v, want %v", err, test.wantErr)
+			}
+
+			if len(got) != test.want {
+				t.Fatalf("%d tasks, want %d", len(got), test.want)
+			}
+
+			for i, gid := range got {
+				if gid != gids[i] {
+					t.Fatalf("task %d is %s, want %s", i, gid, gids[i])
+				}
+			}
+		})
+	}
+}
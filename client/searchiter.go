@@ -0,0 +1,168 @@
+package client
+
+import "context"
+import "errors"
+import "fmt"
+import "net/url"
+import "time"
+
+var ErrSearchTies = errors.New("search results can't be paged")
+
+// SearchIter streams search results page by page, in creation order.
+//
+// Asana search has no cursor, so we page by created_at. Since
+// created_at.after is exclusive and many tasks can share a timestamp, each
+// page is requested from just before the last timestamp seen, and tasks
+// at that timestamp that we already returned are skipped. If more than a
+// page of tasks share one timestamp, the rest can't be reached; Err then
+// returns ErrSearchTies rather than silently skipping them.
+type SearchIter struct {
+	wc         *WorkspaceClient
+	path       string
+	values     *url.Values
+	maxResults int
+
+	page []*Task
+	pos  int
+	last bool
+	err  error
+
+	// GIDs already returned with created_at == cursor
+	cursor     string
+	cursorSeen map[string]bool
+
+	task  *Task
+	count int
+	pages int
+}
+
+// SearchIter returns an iterator over tasks matching q. maxResults caps
+// the number of tasks returned; 0 means no cap.
+func (wc *WorkspaceClient) SearchIter(q *SearchQuery, maxResults int) *SearchIter {
+	return &SearchIter{
+		wc:         wc,
+		path:       fmt.Sprintf("workspaces/%s/tasks/search", wc.workspace.GID),
+		values:     q.values(),
+		maxResults: maxResults,
+		cursorSeen: map[string]bool{},
+	}
+}
+
+// Next advances to the next task, fetching another page if needed. It
+// returns false at the end of results or on error; check Err.
+func (it *SearchIter) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	if it.maxResults > 0 && it.count >= it.maxResults {
+		return false
+	}
+
+	for {
+		for it.pos < len(it.page) {
+			task := it.page[it.pos]
+			it.pos++
+
+			if task.CreatedAt == it.cursor && it.cursorSeen[task.GID] {
+				continue
+			}
+
+			if task.CreatedAt != it.cursor {
+				it.cursor = task.CreatedAt
+				it.cursorSeen = map[string]bool{}
+			}
+			it.cursorSeen[task.GID] = true
+
+			it.task = task
+			it.count++
+			return true
+		}
+
+		if it.last {
+			return false
+		}
+
+		it.err = it.fetch(ctx)
+		if it.err != nil {
+			return false
+		}
+	}
+}
+
+// Task returns the task that Next advanced to
+func (it *SearchIter) Task() *Task {
+	return it.task
+}
+
+func (it *SearchIter) Err() error {
+	return it.err
+}
+
+// Count returns the number of tasks returned so far
+func (it *SearchIter) Count() int {
+	return it.count
+}
+
+// Pages returns the number of pages fetched so far
+func (it *SearchIter) Pages() int {
+	return it.pages
+}
+
+func (it *SearchIter) fetch(ctx context.Context) error {
+	if it.cursor != "" {
+		after, err := justBefore(it.cursor)
+		if err != nil {
+			return err
+		}
+		it.values.Set("created_at.after", after)
+	}
+
+	resp := &tasksResponse{}
+	err := it.wc.client.search(ctx, it.wc.rateLimitSearch, it.path, it.values, resp)
+	if err != nil {
+		return err
+	}
+
+	it.pages++
+
+	for _, task := range resp.Data {
+		err = task.parse()
+		if err != nil {
+			return err
+		}
+	}
+
+	it.page = resp.Data
+	it.pos = 0
+	it.last = len(resp.Data) < perPage
+
+	if !it.last && it.allSeen() {
+		// A full page of one timestamp that we've already returned; asking
+		// again would return the same page, and created_at.after the
+		// timestamp would skip its remaining tasks
+		return fmt.Errorf("%w: more than %d tasks created at %s", ErrSearchTies, perPage, it.cursor)
+	}
+
+	return nil
+}
+
+func (it *SearchIter) allSeen() bool {
+	for _, task := range it.page {
+		if task.CreatedAt != it.cursor || !it.cursorSeen[task.GID] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// justBefore returns a timestamp 1ms (Asana's resolution) before ts
+func justBefore(ts string) (string, error) {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return "", err
+	}
+
+	return t.Add(-time.Millisecond).UTC().Format("2006-01-02T15:04:05.000Z07:00"), nil
+}
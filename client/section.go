@@ -1,5 +1,7 @@
 package client
 
+import "context"
+import "errors"
 import "fmt"
 import "net/url"
 
@@ -13,23 +15,64 @@ type sectionsResponse struct {
 	NextPage *nextPage  `json:"next_page"`
 }
 
+type sectionResponse struct {
+	Data *Section `json:"data"`
+}
+
+type sectionData struct {
+	Name string `json:"name"`
+}
+
+type sectionRequest struct {
+	Data *sectionData `json:"data"`
+}
+
+type sectionInsertData struct {
+	Section       string `json:"section"`
+	BeforeSection string `json:"before_section,omitempty"`
+	AfterSection  string `json:"after_section,omitempty"`
+}
+
+type sectionInsertRequest struct {
+	Data *sectionInsertData `json:"data"`
+}
+
 type sectionAddTaskData struct {
-	Task string `json:"task"`
+	Task         string `json:"task"`
+	InsertBefore string `json:"insert_before,omitempty"`
+	InsertAfter  string `json:"insert_after,omitempty"`
 }
 
 type sectionAddTaskRequest struct {
 	Data *sectionAddTaskData `json:"data"`
 }
 
-func (wc *WorkspaceClient) GetSections(project *Project) ([]*Section, error) {
+func (wc *WorkspaceClient) GetSections(ctx context.Context, project *Project) ([]*Section, error) {
+	path := fmt.Sprintf("projects/%s/sections", project.GID)
+
+	cache := wc.client.cache
+	secs, err := cache.getOrFetch(ctx, path, cache.ttls().Sections, func() (interface{}, error) {
+		return wc.fetchSections(ctx, path)
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			// The project may have been replaced; don't trust cached references to it
+			cache.invalidatePrefix("users/")
+		}
+		return nil, err
+	}
+
+	return secs.([]*Section), nil
+}
+
+func (wc *WorkspaceClient) fetchSections(ctx context.Context, path string) ([]*Section, error) {
 	ret := []*Section{}
 
-	path := fmt.Sprintf("projects/%s/sections", project.GID)
 	values := &url.Values{}
 
 	for {
 		resp := &sectionsResponse{}
-		err := wc.client.get(path, values, resp)
+		err := wc.client.get(ctx, path, values, resp)
 		if err != nil {
 			return nil, err
 		}
@@ -46,8 +89,8 @@ func (wc *WorkspaceClient) GetSections(project *Project) ([]*Section, error) {
 	return ret, nil
 }
 
-func (wc *WorkspaceClient) GetSectionsByName(project *Project) (map[string]*Section, error) {
-	secs, err := wc.GetSections(project)
+func (wc *WorkspaceClient) GetSectionsByName(ctx context.Context, project *Project) (map[string]*Section, error) {
+	secs, err := wc.GetSections(ctx, project)
 	if err != nil {
 		return nil, err
 	}
@@ -60,13 +103,25 @@ func (wc *WorkspaceClient) GetSectionsByName(project *Project) (map[string]*Sect
 	return secsByName, err
 }
 
-func (wc *WorkspaceClient) GetSectionByName(project *Project, name string) (*Section, error) {
-	secsByName, err := wc.GetSectionsByName(project)
+func (wc *WorkspaceClient) GetSectionByName(ctx context.Context, project *Project, name string) (*Section, error) {
+	secsByName, err := wc.GetSectionsByName(ctx, project)
 	if err != nil {
 		return nil, err
 	}
 
 	sec, found := secsByName[name]
+	if !found {
+		// Maybe our cached list is stale
+		wc.InvalidateSections(project)
+
+		secsByName, err = wc.GetSectionsByName(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+
+		sec, found = secsByName[name]
+	}
+
 	if !found {
 		return nil, fmt.Errorf("Section '%s' not found", name)
 	}
@@ -74,37 +129,162 @@ func (wc *WorkspaceClient) GetSectionByName(project *Project, name string) (*Sec
 	return sec, nil
 }
 
-func (wc *WorkspaceClient) AddTaskToSection(task *Task, section *Section) error {
-	req := &sectionAddTaskRequest{
-		Data: &sectionAddTaskData{
-			Task: task.GID,
+func (wc *WorkspaceClient) InvalidateSections(project *Project) {
+	wc.client.cache.invalidate(fmt.Sprintf("projects/%s/sections", project.GID))
+}
+
+// CreateSection adds a section named name at the end of project
+func (wc *WorkspaceClient) CreateSection(ctx context.Context, project *Project, name string) (*Section, error) {
+	req := &sectionRequest{
+		Data: &sectionData{
+			Name: name,
+		},
+	}
+
+	resp := &sectionResponse{}
+	path := fmt.Sprintf("projects/%s/sections", project.GID)
+	err := wc.client.post(ctx, path, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	wc.InvalidateSections(project)
+
+	return resp.Data, nil
+}
+
+func (wc *WorkspaceClient) RenameSection(ctx context.Context, section *Section, name string) (*Section, error) {
+	req := &sectionRequest{
+		Data: &sectionData{
+			Name: name,
 		},
 	}
 
+	resp := &sectionResponse{}
+	path := fmt.Sprintf("sections/%s", section.GID)
+	err := wc.client.put(ctx, path, req, resp)
+
+	// We don't know which project the section belongs to
+	wc.client.cache.invalidatePrefix("projects/")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+// DeleteSection removes an empty section. Asana refuses to delete sections
+// that still contain tasks, and the last section in a project.
+func (wc *WorkspaceClient) DeleteSection(ctx context.Context, section *Section) error {
+	resp := &emptyResponse{}
+	path := fmt.Sprintf("sections/%s", section.GID)
+	err := wc.client.delete(ctx, path, resp)
+
+	// We don't know which project the section belongs to
+	wc.client.cache.invalidatePrefix("projects/")
+
+	return err
+}
+
+func (wc *WorkspaceClient) MoveSectionBefore(ctx context.Context, project *Project, section, before *Section) error {
+	return wc.moveSection(ctx, project, &sectionInsertData{
+		Section:       section.GID,
+		BeforeSection: before.GID,
+	})
+}
+
+func (wc *WorkspaceClient) MoveSectionAfter(ctx context.Context, project *Project, section, after *Section) error {
+	return wc.moveSection(ctx, project, &sectionInsertData{
+		Section:      section.GID,
+		AfterSection: after.GID,
+	})
+}
+
+func (wc *WorkspaceClient) moveSection(ctx context.Context, project *Project, data *sectionInsertData) error {
+	req := &sectionInsertRequest{
+		Data: data,
+	}
+
+	resp := &emptyResponse{}
+	path := fmt.Sprintf("projects/%s/sections/insert", project.GID)
+	err := wc.client.post(ctx, path, req, resp)
+
+	wc.InvalidateSections(project)
+
+	return err
+}
+
+// AddTaskToSection moves task into section, where Asana chooses the position
+func (wc *WorkspaceClient) AddTaskToSection(ctx context.Context, task *Task, section *Section) error {
+	return wc.addTaskToSection(ctx, section, &sectionAddTaskData{
+		Task: task.GID,
+	})
+}
+
+// AddTaskToSectionBefore moves task into section, just above before, which
+// must already be in section
+func (wc *WorkspaceClient) AddTaskToSectionBefore(ctx context.Context, task *Task, section *Section, before *Task) error {
+	return wc.addTaskToSection(ctx, section, &sectionAddTaskData{
+		Task:         task.GID,
+		InsertBefore: before.GID,
+	})
+}
+
+// AddTaskToSectionAfter moves task into section, just below after, which
+// must already be in section
+func (wc *WorkspaceClient) AddTaskToSectionAfter(ctx context.Context, task *Task, section *Section, after *Task) error {
+	return wc.addTaskToSection(ctx, section, &sectionAddTaskData{
+		Task:        task.GID,
+		InsertAfter: after.GID,
+	})
+}
+
+func (wc *WorkspaceClient) addTaskToSection(ctx context.Context, section *Section, data *sectionAddTaskData) error {
+	req := &sectionAddTaskRequest{
+		Data: data,
+	}
+
 	resp := &emptyResponse{}
 
 	path := fmt.Sprintf("sections/%s/addTask", section.GID)
-	err := wc.client.post(path, req, resp)
+	err := wc.client.post(ctx, path, req, resp)
 	if err != nil {
+		wc.sectionNotFound(err)
 		return err
 	}
 
 	return nil
 }
 
-func (wc *WorkspaceClient) GetTasksFromSection(section *Section) ([]*Task, error) {
+func (wc *WorkspaceClient) sectionNotFound(err error) {
+	if errors.Is(err, ErrNotFound) {
+		// We don't know which project the section belonged to
+		wc.client.cache.invalidatePrefix("projects/")
+	}
+}
+
+func (wc *WorkspaceClient) GetTasksFromSection(ctx context.Context, section *Section) ([]*Task, error) {
 	ret := []*Task{}
 
 	path := fmt.Sprintf("sections/%s/tasks", section.GID)
 	values := &url.Values{}
+	values.Set("opt_fields", taskOptFields)
 
 	for {
 		resp := &tasksResponse{}
-		err := wc.client.get(path, values, resp)
+		err := wc.client.get(ctx, path, values, resp)
 		if err != nil {
 			return nil, err
 		}
 
+		for _, task := range resp.Data {
+			err = task.parse()
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		ret = append(ret, resp.Data...)
 
 		if resp.NextPage == nil {
@@ -117,6 +297,22 @@ func (wc *WorkspaceClient) GetTasksFromSection(section *Section) ([]*Task, error
 	return ret, nil
 }
 
+// SectionIsEmpty asks for a single task GID rather than listing the section
+func (wc *WorkspaceClient) SectionIsEmpty(ctx context.Context, section *Section) (bool, error) {
+	path := fmt.Sprintf("sections/%s/tasks", section.GID)
+	values := &url.Values{}
+	values.Set("limit", "1")
+	values.Set("opt_fields", "gid")
+
+	resp := &tasksResponse{}
+	err := wc.client.getUnpaginated(ctx, path, values, resp)
+	if err != nil {
+		return false, err
+	}
+
+	return len(resp.Data) == 0, nil
+}
+
 func (s *Section) String() string {
 	return fmt.Sprintf("%s (%s)", s.GID, s.Name)
 }
@@ -0,0 +1,56 @@
+package client_test
+
+import "context"
+import "fmt"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestSectionIsEmpty(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks int
+		want  bool
+	}{
+		{"empty", 0, true},
+		{"one task", 1, false},
+		{"several pages", 250, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			proj := s.AddProject(wrk, "Project")
+			sec := s.AddSection(proj, "Section")
+
+			for i := 0; i < test.tasks; i++ {
+				s.AddTask(wrk, &asanatest.Task{Name: "Task", Sections: []*client.Section{sec}})
+			}
+
+			ctx := context.Background()
+
+			wc, err := s.Client().InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := wc.SectionIsEmpty(ctx, sec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+
+			reqs := countRequests(s, fmt.Sprintf("GET /sections/%s/tasks", sec.GID))
+			if reqs != 1 {
+				t.Errorf("%d requests, want 1", reqs)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import "context"
+import "fmt"
+import "net/url"
+import "strings"
+import "time"
+
+// Story is an entry in a task's history: either a comment or a system
+// record of a change, distinguished by Type and ResourceSubtype (e.g.
+// "comment_added", "section_changed", "due_date_changed", "assigned")
+type Story struct {
+	GID             string     `json:"gid"`
+	Type            string     `json:"type"`
+	ResourceSubtype string     `json:"resource_subtype"`
+	Text            string     `json:"text"`
+	HTMLText        string     `json:"html_text,omitempty"`
+	CreatedBy       *User      `json:"created_by"`
+	CreatedAt       string     `json:"created_at"`
+	ParsedCreatedAt *time.Time `json:"-"`
+	IsEdited        bool       `json:"is_edited"`
+	IsPinned        bool       `json:"is_pinned"`
+
+	// Set depending on ResourceSubtype
+	Assignee   *User    `json:"assignee,omitempty"`
+	OldSection *Section `json:"old_section,omitempty"`
+	NewSection *Section `json:"new_section,omitempty"`
+	Project    *Project `json:"project,omitempty"`
+	Tag        *Tag     `json:"tag,omitempty"`
+}
+
+type storyResponse struct {
+	Data *Story `json:"data"`
+}
+
+type storiesResponse struct {
+	Data     []*Story  `json:"data"`
+	NextPage *nextPage `json:"next_page"`
+}
+
+type storyCreateData struct {
+	HTMLText string `json:"html_text"`
+}
+
+type storyCreateRequest struct {
+	Data *storyCreateData `json:"data"`
+}
+
+var storyOptFields = strings.Join([]string{
+	"assignee.email",
+	"assignee.name",
+	"created_at",
+	"created_by.email",
+	"created_by.name",
+	"html_text",
+	"is_edited",
+	"is_pinned",
+	"new_section.name",
+	"old_section.name",
+	"project.name",
+	"resource_subtype",
+	"tag.name",
+	"text",
+	"type",
+}, ",")
+
+// GetStories returns task's history, oldest first
+func (wc *WorkspaceClient) GetStories(ctx context.Context, task *Task) ([]*Story, error) {
+	ret := []*Story{}
+
+	path := fmt.Sprintf("tasks/%s/stories", task.GID)
+	values := &url.Values{}
+	values.Set("opt_fields", storyOptFields)
+
+	for {
+		resp := &storiesResponse{}
+		err := wc.client.get(ctx, path, values, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, story := range resp.Data {
+			err = story.parse()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ret = append(ret, resp.Data...)
+
+		if resp.NextPage == nil {
+			break
+		}
+
+		values.Set("offset", resp.NextPage.Offset)
+	}
+
+	return ret, nil
+}
+
+// AddComment adds a comment to task. htmlText must be wrapped in <body>.
+func (wc *WorkspaceClient) AddComment(ctx context.Context, task *Task, htmlText string) (*Story, error) {
+	req := &storyCreateRequest{
+		Data: &storyCreateData{
+			HTMLText: htmlText,
+		},
+	}
+
+	resp := &storyResponse{}
+	path := fmt.Sprintf("tasks/%s/stories?opt_fields=%s", task.GID, url.QueryEscape(storyOptFields))
+	err := wc.client.post(ctx, path, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = resp.Data.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+func (s *Story) IsComment() bool {
+	return s.Type == "comment"
+}
+
+func (s *Story) String() string {
+	return fmt.Sprintf("%s (%s)", s.GID, s.ResourceSubtype)
+}
+
+func (s *Story) parse() error {
+	var err error
+
+	s.ParsedCreatedAt, err = parseTime(s.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package client_test
+
+import "context"
+import "errors"
+import "fmt"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestGetStories(t *testing.T) {
+	tests := []struct {
+		name    string
+		stories int
+		pages   int
+	}{
+		{"none", 0, 1},
+		{"one page", 3, 1},
+		{"several pages", 250, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			me := s.AddUser("Me", "me@example.com")
+			s.SetMe(me)
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+			s.AddTask(wrk, &asanatest.Task{Name: "Other"})
+
+			for i := 0; i < test.stories; i++ {
+				if i%2 == 0 {
+					s.AddStory(gid, &client.Story{
+						ResourceSubtype: "comment_added",
+						Text:            fmt.Sprintf("Comment %d", i),
+					})
+				} else {
+					s.AddStory(gid, &client.Story{
+						ResourceSubtype: "assigned",
+						Text:            fmt.Sprintf("Assigned %d", i),
+						Assignee:        me,
+					})
+				}
+			}
+
+			ctx := context.Background()
+
+			wc, err := s.Client().InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := wc.GetStories(ctx, &client.Task{GID: gid})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pages := countRequests(s, fmt.Sprintf("GET /tasks/%s/stories", gid))
+			if pages != test.pages {
+				t.Errorf("fetched %d pages, want %d", pages, test.pages)
+			}
+
+			want := s.GetStories(gid)
+			if len(got) != len(want) {
+				t.Fatalf("got %d stories, want %d", len(got), len(want))
+			}
+
+			for i, st := range got {
+				if st.GID != want[i].GID || st.Text != want[i].Text {
+					t.Fatalf("story %d is %s %q, want %s %q", i, st, st.Text, want[i], want[i].Text)
+				}
+
+				if st.IsComment() != (i%2 == 0) {
+					t.Errorf("story %d: comment %t", i, st.IsComment())
+				}
+
+				if st.ParsedCreatedAt == nil {
+					t.Errorf("story %d: created_at not parsed", i)
+				}
+
+				if st.CreatedBy == nil || st.CreatedBy.GID != me.GID {
+					t.Errorf("story %d: created by %v, want %s", i, st.CreatedBy, me)
+				}
+
+				if !st.IsComment() && (st.Assignee == nil || st.Assignee.GID != me.GID) {
+					t.Errorf("story %d: assignee %v, want %s", i, st.Assignee, me)
+				}
+			}
+		})
+	}
+}
+
+func TestAddComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		htmlText string
+		wantText string
+		unknown  bool
+		wantErr  error
+	}{
+		{"plain", "<body>Done</body>", "Done", false, nil},
+		{"formatted", "<body><strong>Done</strong> by rule</body>", "Done by rule", false, nil},
+		{"unknown task", "<body>Done</body>", "", true, client.ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+
+			ctx := context.Background()
+
+			wc, err := s.Client().InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			target := &client.Task{GID: gid}
+			if test.unknown {
+				target = &client.Task{GID: "404"}
+			}
+
+			st, err := wc.AddComment(ctx, target, test.htmlText)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("err %v, want %v", err, test.wantErr)
+				}
+
+				if len(s.GetStories(gid)) != 0 {
+					t.Error("comment added to the wrong task")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !st.IsComment() || st.HTMLText != test.htmlText || st.Text != test.wantText {
+				t.Errorf("returned %s %q (%q)", st, st.Text, st.HTMLText)
+			}
+
+			stored := s.GetStories(gid)
+			if len(stored) != 1 {
+				t.Fatalf("%d stories stored, want 1", len(stored))
+			}
+
+			if stored[0].GID != st.GID || stored[0].Text != test.wantText {
+				t.Errorf("stored %s %q, want %s %q", stored[0], stored[0].Text, st, test.wantText)
+			}
+		})
+	}
+}
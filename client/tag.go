@@ -1,5 +1,7 @@
 package client
 
+import "context"
+import "errors"
 import "fmt"
 import "net/url"
 
@@ -8,20 +10,37 @@ type Tag struct {
 	Name string `json:"name"`
 }
 
+type taskTagData struct {
+	Tag string `json:"tag"`
+}
+
 type tagsResponse struct {
 	Data     []*Tag    `json:"data"`
 	NextPage *nextPage `json:"next_page"`
 }
 
-func (wc *WorkspaceClient) GetTags() ([]*Tag, error) {
+func (wc *WorkspaceClient) GetTags(ctx context.Context) ([]*Tag, error) {
+	path := fmt.Sprintf("workspaces/%s/tags", wc.workspace.GID)
+
+	cache := wc.client.cache
+	tags, err := cache.getOrFetch(ctx, path, cache.ttls().Tags, func() (interface{}, error) {
+		return wc.fetchTags(ctx, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags.([]*Tag), nil
+}
+
+func (wc *WorkspaceClient) fetchTags(ctx context.Context, path string) ([]*Tag, error) {
 	ret := []*Tag{}
 
-	path := fmt.Sprintf("workspaces/%s/tags", wc.workspace.GID)
 	values := &url.Values{}
 
 	for {
 		resp := &tagsResponse{}
-		err := wc.client.get(path, values, resp)
+		err := wc.client.get(ctx, path, values, resp)
 		if err != nil {
 			return nil, err
 		}
@@ -38,8 +57,8 @@ func (wc *WorkspaceClient) GetTags() ([]*Tag, error) {
 	return ret, nil
 }
 
-func (wc *WorkspaceClient) GetTagsByName() (map[string]*Tag, error) {
-	tags, err := wc.GetTags()
+func (wc *WorkspaceClient) GetTagsByName(ctx context.Context) (map[string]*Tag, error) {
+	tags, err := wc.GetTags(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -51,3 +70,34 @@ func (wc *WorkspaceClient) GetTagsByName() (map[string]*Tag, error) {
 
 	return tagsByName, err
 }
+
+func (wc *WorkspaceClient) InvalidateTags() {
+	wc.client.cache.invalidate(fmt.Sprintf("workspaces/%s/tags", wc.workspace.GID))
+}
+
+func (wc *WorkspaceClient) AddTag(ctx context.Context, task *Task, tag *Tag) error {
+	return wc.changeTag(ctx, task, "addTag", tag)
+}
+
+func (wc *WorkspaceClient) RemoveTag(ctx context.Context, task *Task, tag *Tag) error {
+	return wc.changeTag(ctx, task, "removeTag", tag)
+}
+
+func (wc *WorkspaceClient) changeTag(ctx context.Context, task *Task, action string, tag *Tag) error {
+	err := wc.postTaskAction(ctx, task, action, &taskTagData{
+		Tag: tag.GID,
+	})
+	if err != nil {
+		wc.tagNotFound(err)
+		return err
+	}
+
+	return nil
+}
+
+func (wc *WorkspaceClient) tagNotFound(err error) {
+	if errors.Is(err, ErrNotFound) {
+		// Could be the task, but could be a deleted tag
+		wc.InvalidateTags()
+	}
+}
@@ -0,0 +1,98 @@
+package client_test
+
+import "context"
+import "errors"
+import "fmt"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tagged  bool
+		remove  bool
+		unknown bool
+		want    bool
+		wantErr error
+	}{
+		{"add", false, false, false, true, nil},
+		{"add again", true, false, false, true, nil},
+		{"remove", true, true, false, false, nil},
+		{"remove absent", false, true, false, false, nil},
+		{"add unknown", false, false, true, false, client.ErrNotFound},
+		{"remove unknown", true, true, true, true, client.ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			s.AddTag(wrk, "Tag")
+
+			ctx := context.Background()
+
+			wc, err := s.Client().InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tags, err := wc.GetTagsByName(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tag := tags["Tag"]
+			if tag == nil {
+				t.Fatalf("Tag missing from %v", tags)
+			}
+
+			task := &asanatest.Task{Name: "Task"}
+			if test.tagged {
+				task.Tags = []*client.Tag{tag}
+			}
+			gid := s.AddTask(wrk, task)
+
+			target := tag
+			if test.unknown {
+				target = &client.Tag{GID: "404"}
+			}
+
+			if test.remove {
+				err = wc.RemoveTag(ctx, &client.Task{GID: gid}, target)
+			} else {
+				err = wc.AddTag(ctx, &client.Task{GID: gid}, target)
+			}
+
+			if test.wantErr == nil && err != nil {
+				t.Fatal(err)
+			}
+
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("err %v, want %v", err, test.wantErr)
+			}
+
+			got := s.GetTask(gid).Tags
+			if (len(got) > 0) != test.want {
+				t.Errorf("tags %v, want tagged %t", got, test.want)
+			}
+
+			// A missing tag may have been deleted, so the list is refetched
+			list := fmt.Sprintf("GET /workspaces/%s/tags", wrk.GID)
+			before := countRequests(s, list)
+
+			_, err = wc.GetTags(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			refetched := countRequests(s, list) > before
+			if refetched != test.unknown {
+				t.Errorf("tags refetched %t, want %t", refetched, test.unknown)
+			}
+		})
+	}
+}
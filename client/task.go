@@ -1,26 +1,55 @@
 package client
 
+import "context"
 import "fmt"
+import "net/url"
 import "strings"
+import "time"
 
 import "cloud.google.com/go/civil"
 import "golang.org/x/net/html"
 
 type Task struct {
-	GID             string           `json:"gid,omitempty"`
-	Name            string           `json:"name,omitempty"`
-	CreatedAt       string           `json:"created_at,omitempty"`
-	DueOn           string           `json:"due_on,omitempty"`
-	ParsedDueOn     *civil.Date      `json:"-"`
-	HTMLNotes       string           `json:"html_notes,omitempty"`
-	ParsedHTMLNotes *html.Node       `json:"-"`
-	AssigneeSection *AssigneeSection `json:"assignee_section"`
+	GID               string           `json:"gid,omitempty"`
+	Name              string           `json:"name,omitempty"`
+	ResourceSubtype   string           `json:"resource_subtype,omitempty"`
+	Assignee          *User            `json:"assignee,omitempty"`
+	Completed         bool             `json:"completed,omitempty"`
+	CompletedAt       string           `json:"completed_at,omitempty"`
+	ParsedCompletedAt *time.Time       `json:"-"`
+	CreatedAt         string           `json:"created_at,omitempty"`
+	ParsedCreatedAt   *time.Time       `json:"-"`
+	ModifiedAt        string           `json:"modified_at,omitempty"`
+	ParsedModifiedAt  *time.Time       `json:"-"`
+	StartOn           string           `json:"start_on,omitempty"`
+	ParsedStartOn     *civil.Date      `json:"-"`
+	DueOn             string           `json:"due_on,omitempty"`
+	ParsedDueOn       *civil.Date      `json:"-"`
+	DueAt             string           `json:"due_at,omitempty"`
+	ParsedDueAt       *time.Time       `json:"-"`
+	HTMLNotes         string           `json:"html_notes,omitempty"`
+	ParsedHTMLNotes   *html.Node       `json:"-"`
+	AssigneeSection   *AssigneeSection `json:"assignee_section"`
+	Projects          []*Project       `json:"projects,omitempty"`
+	Memberships       []*Membership    `json:"memberships,omitempty"`
+	Tags              []*Tag           `json:"tags,omitempty"`
+	Followers         []*User          `json:"followers,omitempty"`
+	Parent            *Task            `json:"parent,omitempty"`
+	NumSubtasks       int              `json:"num_subtasks,omitempty"`
+	CustomFields      []*CustomField   `json:"custom_fields,omitempty"`
+	PermalinkURL      string           `json:"permalink_url,omitempty"`
 }
 
 type AssigneeSection struct {
 	GID string `json:"gid,omitempty"`
 }
 
+// Membership is a task's placement in a project (not a user task list)
+type Membership struct {
+	Project *Project `json:"project,omitempty"`
+	Section *Section `json:"section,omitempty"`
+}
+
 type taskResponse struct {
 	Data *Task `json:"data"`
 }
@@ -31,25 +60,66 @@ type tasksResponse struct {
 }
 
 type taskUpdate struct {
-	Data *Task `json:"data"`
+	Data map[string]interface{} `json:"data"`
 }
 
-func (wc *WorkspaceClient) UpdateTask(task *Task) error {
-	path := fmt.Sprintf("tasks/%s", task.GID)
-
-	task.GID = ""
+// Fields requested whenever we fetch tasks, so everything in Task is populated
+var taskOptFields = strings.Join([]string{
+	"assignee.email",
+	"assignee.name",
+	"assignee_section",
+	"completed",
+	"completed_at",
+	"created_at",
+	"custom_fields.date_value",
+	"custom_fields.display_value",
+	"custom_fields.enum_value.name",
+	"custom_fields.multi_enum_values.name",
+	"custom_fields.name",
+	"custom_fields.number_value",
+	"custom_fields.people_value.email",
+	"custom_fields.people_value.name",
+	"custom_fields.resource_subtype",
+	"custom_fields.text_value",
+	"custom_fields.type",
+	"due_at",
+	"due_on",
+	"followers.email",
+	"followers.name",
+	"html_notes",
+	"memberships.project.name",
+	"memberships.section.name",
+	"modified_at",
+	"name",
+	"num_subtasks",
+	"parent.name",
+	"permalink_url",
+	"projects.name",
+	"resource_subtype",
+	"start_on",
+	"tags.name",
+}, ",")
 
+// UpdateTask applies patch to task and returns the updated task. task itself
+// is not modified.
+func (wc *WorkspaceClient) UpdateTask(ctx context.Context, task *Task, patch *TaskPatch) (*Task, error) {
 	update := &taskUpdate{
-		Data: task,
+		Data: patch.data(),
 	}
 
 	resp := &taskResponse{}
-	err := wc.client.put(path, update, resp)
+	path := withOptFields(fmt.Sprintf("tasks/%s", task.GID))
+	err := wc.client.put(ctx, path, update, resp)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	err = resp.Data.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
 }
 
 func (t *Task) String() string {
@@ -64,13 +134,364 @@ func (t *Task) parse() error {
 	}
 	t.ParsedHTMLNotes = root
 
-	if t.DueOn != "" {
-		d, err := civil.ParseDate(t.DueOn)
+	t.ParsedDueOn, err = parseDate(t.DueOn)
+	if err != nil {
+		return err
+	}
+
+	t.ParsedStartOn, err = parseDate(t.StartOn)
+	if err != nil {
+		return err
+	}
+
+	t.ParsedDueAt, err = parseTime(t.DueAt)
+	if err != nil {
+		return err
+	}
+
+	t.ParsedCreatedAt, err = parseTime(t.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	t.ParsedModifiedAt, err = parseTime(t.ModifiedAt)
+	if err != nil {
+		return err
+	}
+
+	t.ParsedCompletedAt, err = parseTime(t.CompletedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *Membership) String() string {
+	if m.Section == nil {
+		return m.Project.String()
+	}
+
+	return fmt.Sprintf("%s / %s", m.Project, m.Section)
+}
+
+func parseDate(s string) (*civil.Date, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	d, err := civil.ParseDate(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func parseTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+type taskCreateData struct {
+	Workspace       string   `json:"workspace"`
+	Name            string   `json:"name,omitempty"`
+	ResourceSubtype string   `json:"resource_subtype,omitempty"`
+	HTMLNotes       string   `json:"html_notes,omitempty"`
+	Assignee        string   `json:"assignee,omitempty"`
+	AssigneeSection string   `json:"assignee_section,omitempty"`
+	Completed       bool     `json:"completed,omitempty"`
+	StartOn         string   `json:"start_on,omitempty"`
+	DueOn           string   `json:"due_on,omitempty"`
+	DueAt           string   `json:"due_at,omitempty"`
+	Parent          string   `json:"parent,omitempty"`
+	Projects        []string `json:"projects,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	Followers       []string `json:"followers,omitempty"`
+}
+
+type taskCreateRequest struct {
+	Data *taskCreateData `json:"data"`
+}
+
+type taskDuplicateData struct {
+	Name    string `json:"name"`
+	Include string `json:"include,omitempty"`
+}
+
+type taskDuplicateRequest struct {
+	Data *taskDuplicateData `json:"data"`
+}
+
+type job struct {
+	GID     string `json:"gid"`
+	Status  string `json:"status"`
+	NewTask *Task  `json:"new_task"`
+}
+
+type jobResponse struct {
+	Data *job `json:"data"`
+}
+
+type taskSetParentData struct {
+	// Explicitly null to remove the parent
+	Parent *string `json:"parent"`
+}
+
+type taskSetParentRequest struct {
+	Data *taskSetParentData `json:"data"`
+}
+
+type taskDependenciesData struct {
+	Dependencies []string `json:"dependencies"`
+}
+
+type taskFollowersData struct {
+	Followers []string `json:"followers"`
+}
+
+type taskActionRequest struct {
+	Data interface{} `json:"data"`
+}
+
+func (wc *WorkspaceClient) GetTask(ctx context.Context, gid string) (*Task, error) {
+	path := fmt.Sprintf("tasks/%s", gid)
+
+	values := &url.Values{}
+	values.Set("opt_fields", taskOptFields)
+
+	resp := &taskResponse{}
+	err := wc.client.getUnpaginated(ctx, path, values, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = resp.Data.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+func (wc *WorkspaceClient) GetSubtasks(ctx context.Context, task *Task) ([]*Task, error) {
+	ret := []*Task{}
+
+	path := fmt.Sprintf("tasks/%s/subtasks", task.GID)
+	values := &url.Values{}
+	values.Set("opt_fields", taskOptFields)
+
+	for {
+		resp := &tasksResponse{}
+		err := wc.client.get(ctx, path, values, resp)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		for _, subtask := range resp.Data {
+			err = subtask.parse()
+			if err != nil {
+				return nil, err
+			}
 		}
-		t.ParsedDueOn = &d
+
+		ret = append(ret, resp.Data...)
+
+		if resp.NextPage == nil {
+			break
+		}
+
+		values.Set("offset", resp.NextPage.Offset)
 	}
 
-	return nil
+	return ret, nil
+}
+
+// CreateTask creates a task in this workspace from the writable fields of
+// task, and returns the created task. Related objects (Assignee, Projects,
+// Tags, Followers, Parent) only need GID set.
+func (wc *WorkspaceClient) CreateTask(ctx context.Context, task *Task) (*Task, error) {
+	data := &taskCreateData{
+		Workspace:       wc.workspace.GID,
+		Name:            task.Name,
+		ResourceSubtype: task.ResourceSubtype,
+		HTMLNotes:       task.HTMLNotes,
+		Completed:       task.Completed,
+		StartOn:         task.StartOn,
+		DueOn:           task.DueOn,
+		DueAt:           task.DueAt,
+	}
+
+	if task.Assignee != nil {
+		data.Assignee = task.Assignee.GID
+	}
+
+	if task.AssigneeSection != nil {
+		data.AssigneeSection = task.AssigneeSection.GID
+	}
+
+	if task.Parent != nil {
+		data.Parent = task.Parent.GID
+	}
+
+	for _, project := range task.Projects {
+		data.Projects = append(data.Projects, project.GID)
+	}
+
+	for _, tag := range task.Tags {
+		data.Tags = append(data.Tags, tag.GID)
+	}
+
+	for _, follower := range task.Followers {
+		data.Followers = append(data.Followers, follower.GID)
+	}
+
+	req := &taskCreateRequest{
+		Data: data,
+	}
+
+	resp := &taskResponse{}
+	err := wc.client.post(ctx, withOptFields("tasks"), req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = resp.Data.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+func (wc *WorkspaceClient) DeleteTask(ctx context.Context, task *Task) error {
+	path := fmt.Sprintf("tasks/%s", task.GID)
+	resp := &emptyResponse{}
+	return wc.client.delete(ctx, path, resp)
+}
+
+func (wc *WorkspaceClient) CompleteTask(ctx context.Context, task *Task) (*Task, error) {
+	return wc.UpdateTask(ctx, task, NewTaskPatch().SetCompleted(true))
+}
+
+func (wc *WorkspaceClient) ReopenTask(ctx context.Context, task *Task) (*Task, error) {
+	return wc.UpdateTask(ctx, task, NewTaskPatch().SetCompleted(false))
+}
+
+// DuplicateTask copies task under a new name. include lists what to copy
+// (e.g. "notes", "assignee", "subtasks", "projects", "tags", "dates");
+// see the Asana docs for the full list. Asana copies asynchronously, so
+// some included content may appear after this returns.
+func (wc *WorkspaceClient) DuplicateTask(ctx context.Context, task *Task, name string, include []string) (*Task, error) {
+	req := &taskDuplicateRequest{
+		Data: &taskDuplicateData{
+			Name:    name,
+			Include: strings.Join(include, ","),
+		},
+	}
+
+	resp := &jobResponse{}
+	path := fmt.Sprintf("tasks/%s/duplicate", task.GID)
+	err := wc.client.post(ctx, path, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Data == nil || resp.Data.NewTask == nil {
+		return nil, fmt.Errorf("duplicate of %s returned no new task", task)
+	}
+
+	return wc.GetTask(ctx, resp.Data.NewTask.GID)
+}
+
+// SetParent makes task a subtask of parent, or a top-level task if parent
+// is nil
+func (wc *WorkspaceClient) SetParent(ctx context.Context, task *Task, parent *Task) (*Task, error) {
+	data := &taskSetParentData{}
+	if parent != nil {
+		data.Parent = &parent.GID
+	}
+
+	req := &taskSetParentRequest{
+		Data: data,
+	}
+
+	resp := &taskResponse{}
+	path := withOptFields(fmt.Sprintf("tasks/%s/setParent", task.GID))
+	err := wc.client.post(ctx, path, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = resp.Data.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+// AddDependencies marks task as blocked by each of deps
+func (wc *WorkspaceClient) AddDependencies(ctx context.Context, task *Task, deps []*Task) error {
+	return wc.changeDependencies(ctx, task, "addDependencies", deps)
+}
+
+func (wc *WorkspaceClient) RemoveDependencies(ctx context.Context, task *Task, deps []*Task) error {
+	return wc.changeDependencies(ctx, task, "removeDependencies", deps)
+}
+
+func (wc *WorkspaceClient) AddFollowers(ctx context.Context, task *Task, users []*User) error {
+	return wc.postTaskAction(ctx, task, "addFollowers", newTaskFollowersData(users))
+}
+
+func (wc *WorkspaceClient) RemoveFollowers(ctx context.Context, task *Task, users []*User) error {
+	return wc.postTaskAction(ctx, task, "removeFollowers", newTaskFollowersData(users))
+}
+
+func (wc *WorkspaceClient) changeDependencies(ctx context.Context, task *Task, op string, deps []*Task) error {
+	gids := []string{}
+	for _, dep := range deps {
+		gids = append(gids, dep.GID)
+	}
+
+	return wc.postTaskAction(ctx, task, op, &taskDependenciesData{
+		Dependencies: gids,
+	})
+}
+
+// postTaskAction POSTs to one of the tasks/{gid}/{action} endpoints that
+// return an empty response
+func (wc *WorkspaceClient) postTaskAction(ctx context.Context, task *Task, action string, data interface{}) error {
+	req := &taskActionRequest{
+		Data: data,
+	}
+
+	resp := &emptyResponse{}
+	path := fmt.Sprintf("tasks/%s/%s", task.GID, action)
+	return wc.client.post(ctx, path, req, resp)
+}
+
+// withOptFields requests all Task fields in the response to a write
+func withOptFields(path string) string {
+	return fmt.Sprintf("%s?opt_fields=%s", path, url.QueryEscape(taskOptFields))
+}
+
+func newTaskFollowersData(users []*User) *taskFollowersData {
+	data := &taskFollowersData{
+		Followers: []string{},
+	}
+
+	for _, user := range users {
+		data.Followers = append(data.Followers, user.GID)
+	}
+
+	return data
 }
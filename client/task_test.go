@@ -0,0 +1,319 @@
+package client_test
+
+import "context"
+import "errors"
+import "strings"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+type taskFixture struct {
+	s      *asanatest.Server
+	user   *client.User
+	tag    *client.Tag
+	task   *client.Task
+	parent *client.Task
+	other  *client.Task
+
+	// Set by run for check
+	result *client.Task
+}
+
+func TestTaskLifecycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   func(context.Context, *client.WorkspaceClient, *taskFixture) error
+		check func(*testing.T, *taskFixture)
+	}{
+		{
+			name: "create",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				var err error
+				f.result, err = wc.CreateTask(ctx, &client.Task{
+					Name:      "Created",
+					HTMLNotes: "<body>Notes</body>",
+					Assignee:  f.user,
+					Parent:    f.parent,
+					Tags:      []*client.Tag{f.tag},
+					Followers: []*client.User{f.user},
+				})
+				return err
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				got := f.s.GetTask(f.result.GID)
+				if got == nil {
+					t.Fatal("task not created")
+				}
+
+				if got.Name != "Created" || got.HTMLNotes != "<body>Notes</body>" {
+					t.Errorf("created %q with notes %q", got.Name, got.HTMLNotes)
+				}
+
+				if got.Assignee == nil || got.Assignee.GID != f.user.GID {
+					t.Errorf("assignee %v, want %s", got.Assignee, f.user)
+				}
+
+				if got.Parent != f.parent.GID {
+					t.Errorf("parent %s, want %s", got.Parent, f.parent.GID)
+				}
+
+				if len(got.Tags) != 1 || got.Tags[0].GID != f.tag.GID {
+					t.Errorf("tags %v, want [%s]", got.Tags, f.tag)
+				}
+
+				if len(got.Followers) != 1 || got.Followers[0].GID != f.user.GID {
+					t.Errorf("followers %v, want [%s]", got.Followers, f.user)
+				}
+			},
+		},
+		{
+			name: "delete",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				err := wc.DeleteTask(ctx, f.task)
+				if err != nil {
+					return err
+				}
+
+				err = wc.DeleteTask(ctx, f.task)
+				if !errors.Is(err, client.ErrNotFound) {
+					return errors.New("second delete didn't return not found")
+				}
+
+				return nil
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				if f.s.GetTask(f.task.GID) != nil {
+					t.Error("task not deleted")
+				}
+			},
+		},
+		{
+			name: "complete",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				var err error
+				f.result, err = wc.CompleteTask(ctx, f.task)
+				return err
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				got := f.s.GetTask(f.task.GID)
+				if !got.Completed || got.CompletedAt == "" {
+					t.Errorf("completed %t at %q", got.Completed, got.CompletedAt)
+				}
+
+				if !f.result.Completed {
+					t.Error("returned task not completed")
+				}
+			},
+		},
+		{
+			name: "reopen",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				_, err := wc.CompleteTask(ctx, f.task)
+				if err != nil {
+					return err
+				}
+
+				f.result, err = wc.ReopenTask(ctx, f.task)
+				return err
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				got := f.s.GetTask(f.task.GID)
+				if got.Completed {
+					t.Error("task still completed")
+				}
+			},
+		},
+		{
+			name: "duplicate",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				var err error
+				f.result, err = wc.DuplicateTask(ctx, f.parent, "Copy", []string{"notes", "tags", "subtasks"})
+				return err
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				got := f.s.GetTask(f.result.GID)
+				if got == nil {
+					t.Fatal("duplicate not created")
+				}
+
+				if got.Name != "Copy" || got.HTMLNotes != "<body>Parent notes</body>" {
+					t.Errorf("duplicated %q with notes %q", got.Name, got.HTMLNotes)
+				}
+
+				if len(got.Tags) != 1 || got.Tags[0].GID != f.tag.GID {
+					t.Errorf("tags %v, want [%s]", got.Tags, f.tag)
+				}
+
+				if f.s.GetTask(f.parent.GID).Name != "Parent" {
+					t.Error("original changed")
+				}
+			},
+		},
+		{
+			name: "duplicate subtasks",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				dup, err := wc.DuplicateTask(ctx, f.parent, "Copy", []string{"subtasks"})
+				if err != nil {
+					return err
+				}
+
+				subtasks, err := wc.GetSubtasks(ctx, dup)
+				if err != nil {
+					return err
+				}
+
+				if len(subtasks) != 1 || subtasks[0].Name != "Child" {
+					return errors.New("subtasks not copied")
+				}
+
+				f.result = subtasks[0]
+				return nil
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				if f.result.GID == f.task.GID {
+					t.Error("subtask moved instead of copied")
+				}
+
+				if f.s.GetTask(f.task.GID).Parent != f.parent.GID {
+					t.Error("original subtask reparented")
+				}
+			},
+		},
+		{
+			name: "reparent",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				var err error
+				f.result, err = wc.SetParent(ctx, f.task, f.other)
+				return err
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				got := f.s.GetTask(f.task.GID)
+				if got.Parent != f.other.GID {
+					t.Errorf("parent %s, want %s", got.Parent, f.other.GID)
+				}
+			},
+		},
+		{
+			name: "make top-level",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				var err error
+				f.result, err = wc.SetParent(ctx, f.task, nil)
+				return err
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				got := f.s.GetTask(f.task.GID)
+				if got.Parent != "" {
+					t.Errorf("parent %s, want none", got.Parent)
+				}
+			},
+		},
+		{
+			name: "dependencies",
+			run: func(ctx context.Context, wc *client.WorkspaceClient, f *taskFixture) error {
+				err := wc.AddDependencies(ctx, f.task, []*client.Task{f.parent, f.other})
+				if err != nil {
+					return err
+				}
+
+				return wc.RemoveDependencies(ctx, f.task, []*client.Task{f.parent})
+			},
+			check: func(t *testing.T, f *taskFixture) {
+				got := f.s.GetTask(f.task.GID)
+				if strings.Join(got.Dependencies, ",") != f.other.GID {
+					t.Errorf("dependencies %v, want [%s]", got.Dependencies, f.other.GID)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+
+			f := &taskFixture{
+				s:    s,
+				user: s.AddUser("User", "user@example.com"),
+				tag:  s.AddTag(wrk, "Tag"),
+			}
+
+			f.parent = &client.Task{GID: s.AddTask(wrk, &asanatest.Task{
+				Name:      "Parent",
+				HTMLNotes: "<body>Parent notes</body>",
+				Tags:      []*client.Tag{f.tag},
+			})}
+			f.task = &client.Task{GID: s.AddTask(wrk, &asanatest.Task{
+				Name:   "Child",
+				Parent: f.parent.GID,
+			})}
+			f.other = &client.Task{GID: s.AddTask(wrk, &asanatest.Task{Name: "Other"})}
+
+			ctx := context.Background()
+
+			wc, err := s.Client().InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = test.run(ctx, wc, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.check(t, f)
+		})
+	}
+}
+
+func TestTaskFollowers(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	wrk := s.AddWorkspace("Work")
+	alice := s.AddUser("Alice", "alice@example.com")
+	bob := s.AddUser("Bob", "bob@example.com")
+	task := &client.Task{GID: s.AddTask(wrk, &asanatest.Task{Name: "Task"})}
+
+	ctx := context.Background()
+
+	wc, err := s.Client().InWorkspace(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name   string
+		change func() error
+		want   []*client.User
+	}{
+		{"add", func() error { return wc.AddFollowers(ctx, task, []*client.User{alice, bob}) }, []*client.User{alice, bob}},
+		{"add again", func() error { return wc.AddFollowers(ctx, task, []*client.User{alice}) }, []*client.User{alice, bob}},
+		{"remove", func() error { return wc.RemoveFollowers(ctx, task, []*client.User{alice}) }, []*client.User{bob}},
+		{"remove absent", func() error { return wc.RemoveFollowers(ctx, task, []*client.User{alice}) }, []*client.User{bob}},
+		{"remove last", func() error { return wc.RemoveFollowers(ctx, task, []*client.User{bob}) }, []*client.User{}},
+	}
+
+	for _, step := range steps {
+		err = step.change()
+		if err != nil {
+			t.Fatalf("%s: %s", step.name, err)
+		}
+
+		got := []string{}
+		for _, u := range s.GetTask(task.GID).Followers {
+			got = append(got, u.GID)
+		}
+
+		want := []string{}
+		for _, u := range step.want {
+			want = append(want, u.GID)
+		}
+
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: followers %v, want %v", step.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import "encoding/json"
+import "time"
+
+import "cloud.google.com/go/civil"
+
+const emptyHTMLNotes = "<body></body>"
+
+// TaskPatch is a partial update to a task. Only fields that were Set or
+// Cleared are sent; Clear sends an explicit null.
+type TaskPatch struct {
+	fields       map[string]interface{}
+	customFields map[string]interface{}
+}
+
+func NewTaskPatch() *TaskPatch {
+	return &TaskPatch{
+		fields:       map[string]interface{}{},
+		customFields: map[string]interface{}{},
+	}
+}
+
+func (p *TaskPatch) SetName(name string) *TaskPatch {
+	p.fields["name"] = name
+	return p
+}
+
+// SetHTMLNotes sets rich text notes, which Asana requires to be wrapped in
+// <body>; "" clears them
+func (p *TaskPatch) SetHTMLNotes(notes string) *TaskPatch {
+	if notes == "" {
+		return p.ClearHTMLNotes()
+	}
+
+	p.fields["html_notes"] = notes
+	return p
+}
+
+// ClearHTMLNotes blanks the notes. Asana rejects null and "" here.
+func (p *TaskPatch) ClearHTMLNotes() *TaskPatch {
+	p.fields["html_notes"] = emptyHTMLNotes
+	return p
+}
+
+func (p *TaskPatch) SetCompleted(completed bool) *TaskPatch {
+	p.fields["completed"] = completed
+	return p
+}
+
+func (p *TaskPatch) SetStartOn(date civil.Date) *TaskPatch {
+	p.fields["start_on"] = date.String()
+	return p
+}
+
+func (p *TaskPatch) ClearStartOn() *TaskPatch {
+	p.fields["start_on"] = nil
+	return p
+}
+
+// SetDueOn replaces any due_at in this patch; a task has one or the other
+func (p *TaskPatch) SetDueOn(date civil.Date) *TaskPatch {
+	p.fields["due_on"] = date.String()
+	delete(p.fields, "due_at")
+	return p
+}
+
+func (p *TaskPatch) ClearDueOn() *TaskPatch {
+	p.fields["due_on"] = nil
+	return p
+}
+
+// SetDueAt replaces any due_on in this patch; a task has one or the other
+func (p *TaskPatch) SetDueAt(t time.Time) *TaskPatch {
+	p.fields["due_at"] = t.UTC().Format(time.RFC3339Nano)
+	delete(p.fields, "due_on")
+	return p
+}
+
+func (p *TaskPatch) ClearDueAt() *TaskPatch {
+	p.fields["due_at"] = nil
+	return p
+}
+
+func (p *TaskPatch) SetAssignee(user *User) *TaskPatch {
+	p.fields["assignee"] = user.GID
+	return p
+}
+
+func (p *TaskPatch) ClearAssignee() *TaskPatch {
+	p.fields["assignee"] = nil
+	return p
+}
+
+func (p *TaskPatch) SetAssigneeSection(section *Section) *TaskPatch {
+	p.fields["assignee_section"] = section.GID
+	return p
+}
+
+// SetCustomField sets the raw value of a custom field: a string for text,
+// a float64 for number, an enum option GID for enum, or a []string of
+// option GIDs for multi_enum.
+func (p *TaskPatch) SetCustomField(gid string, value interface{}) *TaskPatch {
+	p.customFields[gid] = value
+	return p
+}
+
+func (p *TaskPatch) ClearCustomField(gid string) *TaskPatch {
+	p.customFields[gid] = nil
+	return p
+}
+
+func (p *TaskPatch) IsEmpty() bool {
+	return len(p.fields) == 0 && len(p.customFields) == 0
+}
+
+func (p *TaskPatch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.data())
+}
+
+func (p *TaskPatch) data() map[string]interface{} {
+	data := map[string]interface{}{}
+
+	for key, val := range p.fields {
+		data[key] = val
+	}
+
+	if len(p.customFields) > 0 {
+		cfs := map[string]interface{}{}
+		for gid, val := range p.customFields {
+			cfs[gid] = val
+		}
+		data["custom_fields"] = cfs
+	}
+
+	return data
+}
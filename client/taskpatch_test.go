@@ -0,0 +1,44 @@
+package client_test
+
+import "context"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestClearHTMLNotes(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch *client.TaskPatch
+	}{
+		{"ClearHTMLNotes", client.NewTaskPatch().ClearHTMLNotes()},
+		{"SetHTMLNotes empty", client.NewTaskPatch().SetHTMLNotes("")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task", HTMLNotes: "<body>Notes</body>"})
+
+			ctx := context.Background()
+
+			wc, err := s.Client().InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = wc.UpdateTask(ctx, &client.Task{GID: gid}, test.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.GetTask(gid).HTMLNotes
+			if got != "<body></body>" {
+				t.Errorf("notes %q, want <body></body>", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import "context"
+import "fmt"
+import "net/url"
+
+type Team struct {
+	GID  string `json:"gid"`
+	Name string `json:"name"`
+}
+
+type teamsResponse struct {
+	Data     []*Team   `json:"data"`
+	NextPage *nextPage `json:"next_page"`
+}
+
+func (wc *WorkspaceClient) GetTeams(ctx context.Context) ([]*Team, error) {
+	path := fmt.Sprintf("workspaces/%s/teams", wc.workspace.GID)
+
+	cache := wc.client.cache
+	teams, err := cache.getOrFetch(ctx, path, cache.ttls().Teams, func() (interface{}, error) {
+		return wc.fetchTeams(ctx, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return teams.([]*Team), nil
+}
+
+func (wc *WorkspaceClient) fetchTeams(ctx context.Context, path string) ([]*Team, error) {
+	ret := []*Team{}
+
+	values := &url.Values{}
+
+	for {
+		resp := &teamsResponse{}
+		err := wc.client.get(ctx, path, values, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, resp.Data...)
+
+		if resp.NextPage == nil {
+			break
+		}
+
+		values.Set("offset", resp.NextPage.Offset)
+	}
+
+	return ret, nil
+}
+
+func (wc *WorkspaceClient) GetTeamsByName(ctx context.Context) (map[string]*Team, error) {
+	teams, err := wc.GetTeams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	teamsByName := map[string]*Team{}
+	for _, team := range teams {
+		teamsByName[team.Name] = team
+	}
+
+	return teamsByName, err
+}
+
+func (t *Team) String() string {
+	return fmt.Sprintf("%s (%s)", t.GID, t.Name)
+}
+
+func (wc *WorkspaceClient) InvalidateTeams() {
+	wc.client.cache.invalidate(fmt.Sprintf("workspaces/%s/teams", wc.workspace.GID))
+}
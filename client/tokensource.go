@@ -0,0 +1,32 @@
+package client
+
+import "context"
+
+// TokenSource supplies the bearer token for each request
+type TokenSource interface {
+	// Token returns a currently valid access token
+	Token(ctx context.Context) (string, error)
+
+	// Invalidate reports that the server rejected token, and returns
+	// whether retrying with a fresh Token is worthwhile
+	Invalidate(token string) bool
+}
+
+type staticTokenSource struct {
+	token string
+}
+
+// NewStaticTokenSource always returns token, e.g. a personal access token
+func NewStaticTokenSource(token string) TokenSource {
+	return &staticTokenSource{
+		token: token,
+	}
+}
+
+func (s *staticTokenSource) Token(ctx context.Context) (string, error) {
+	return s.token, nil
+}
+
+func (s *staticTokenSource) Invalidate(token string) bool {
+	return false
+}
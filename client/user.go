@@ -1,6 +1,8 @@
 package client
 
+import "context"
 import "fmt"
+import "net/url"
 
 type User struct {
 	GID   string `json:"gid"`
@@ -12,13 +14,90 @@ type userResponse struct {
 	Data *User `json:"data"`
 }
 
-func (wc *WorkspaceClient) GetMe() (*User, error) {
-	resp := &userResponse{}
-	err := wc.client.get("users/me", nil, resp)
+type usersResponse struct {
+	Data     []*User   `json:"data"`
+	NextPage *nextPage `json:"next_page"`
+}
+
+func (wc *WorkspaceClient) GetMe(ctx context.Context) (*User, error) {
+	cache := wc.client.cache
+	u, err := cache.getOrFetch(ctx, "users/me", cache.ttls().Users, func() (interface{}, error) {
+		resp := &userResponse{}
+		err := wc.client.get(ctx, "users/me", nil, resp)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u.(*User), nil
+}
+
+func (wc *WorkspaceClient) GetUsers(ctx context.Context) ([]*User, error) {
+	path := fmt.Sprintf("workspaces/%s/users", wc.workspace.GID)
+
+	cache := wc.client.cache
+	users, err := cache.getOrFetch(ctx, path, cache.ttls().Users, func() (interface{}, error) {
+		return wc.fetchUsers(ctx, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users.([]*User), nil
+}
+
+func (wc *WorkspaceClient) fetchUsers(ctx context.Context, path string) ([]*User, error) {
+	ret := []*User{}
+
+	values := &url.Values{}
+	values.Set("opt_fields", "email,name")
+
+	for {
+		resp := &usersResponse{}
+		err := wc.client.get(ctx, path, values, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, resp.Data...)
+
+		if resp.NextPage == nil {
+			break
+		}
+
+		values.Set("offset", resp.NextPage.Offset)
+	}
+
+	return ret, nil
+}
+
+func (wc *WorkspaceClient) InvalidateUsers() {
+	wc.client.cache.invalidate(fmt.Sprintf("workspaces/%s/users", wc.workspace.GID))
+}
+
+// GetUser looks up a user by GID or email address
+func (wc *WorkspaceClient) GetUser(ctx context.Context, id string) (*User, error) {
+	path := fmt.Sprintf("users/%s", id)
+
+	cache := wc.client.cache
+	u, err := cache.getOrFetch(ctx, path, cache.ttls().Users, func() (interface{}, error) {
+		values := &url.Values{}
+		values.Set("opt_fields", "email,name")
+
+		resp := &userResponse{}
+		err := wc.client.getUnpaginated(ctx, path, values, resp)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Data, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return resp.Data, nil
+	return u.(*User), nil
 }
 
 func (u *User) String() string {
@@ -1,27 +1,37 @@
 package client
 
+import "context"
 import "fmt"
 import "net/url"
 
 // UserTaskLists are actually Projects
 
-func (wc *WorkspaceClient) GetUserTaskList(user *User) (*Project, error) {
+func (wc *WorkspaceClient) GetUserTaskList(ctx context.Context, user *User) (*Project, error) {
 	path := fmt.Sprintf("users/%s/user_task_list", user.GID)
-	values := &url.Values{}
-	values.Add("workspace", wc.workspace.GID)
-	resp := &projectResponse{}
-	err := wc.client.get(path, values, resp)
+
+	cache := wc.client.cache
+	key := fmt.Sprintf("%s?workspace=%s", path, wc.workspace.GID)
+	utl, err := cache.getOrFetch(ctx, key, cache.ttls().UserTaskLists, func() (interface{}, error) {
+		values := &url.Values{}
+		values.Add("workspace", wc.workspace.GID)
+		resp := &projectResponse{}
+		err := wc.client.get(ctx, path, values, resp)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Data, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return resp.Data, nil
+	return utl.(*Project), nil
 }
 
-func (wc *WorkspaceClient) GetMyUserTaskList() (*Project, error) {
-	me, err := wc.GetMe()
+func (wc *WorkspaceClient) GetMyUserTaskList(ctx context.Context) (*Project, error) {
+	me, err := wc.GetMe(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return wc.GetUserTaskList(me)
+	return wc.GetUserTaskList(ctx, me)
 }
@@ -0,0 +1,84 @@
+package client
+
+import "context"
+import "fmt"
+import "net/url"
+
+type Webhook struct {
+	GID      string         `json:"gid,omitempty"`
+	Active   bool           `json:"active,omitempty"`
+	Target   string         `json:"target,omitempty"`
+	Resource *EventResource `json:"resource,omitempty"`
+}
+
+type webhookResponse struct {
+	Data *Webhook `json:"data"`
+}
+
+type webhooksResponse struct {
+	Data     []*Webhook `json:"data"`
+	NextPage *nextPage  `json:"next_page"`
+}
+
+type webhookCreateData struct {
+	Resource string `json:"resource"`
+	Target   string `json:"target"`
+}
+
+type webhookCreateRequest struct {
+	Data *webhookCreateData `json:"data"`
+}
+
+// CreateWebhook asks Asana to deliver events on resource to target. Asana
+// performs the X-Hook-Secret handshake with target before this returns.
+func (wc *WorkspaceClient) CreateWebhook(ctx context.Context, resource string, target string) (*Webhook, error) {
+	req := &webhookCreateRequest{
+		Data: &webhookCreateData{
+			Resource: resource,
+			Target:   target,
+		},
+	}
+
+	resp := &webhookResponse{}
+	err := wc.client.post(ctx, "webhooks", req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+func (wc *WorkspaceClient) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	ret := []*Webhook{}
+
+	values := &url.Values{}
+	values.Set("workspace", wc.workspace.GID)
+
+	for {
+		resp := &webhooksResponse{}
+		err := wc.client.get(ctx, "webhooks", values, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, resp.Data...)
+
+		if resp.NextPage == nil {
+			break
+		}
+
+		values.Set("offset", resp.NextPage.Offset)
+	}
+
+	return ret, nil
+}
+
+func (wc *WorkspaceClient) DeleteWebhook(ctx context.Context, webhook *Webhook) error {
+	path := fmt.Sprintf("webhooks/%s", webhook.GID)
+	resp := &emptyResponse{}
+	return wc.client.delete(ctx, path, resp)
+}
+
+func (w *Webhook) String() string {
+	return fmt.Sprintf("%s (%s)", w.GID, w.Target)
+}
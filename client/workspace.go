@@ -1,5 +1,6 @@
 package client
 
+import "context"
 import "fmt"
 import "net/url"
 
@@ -13,8 +14,8 @@ type workspacesResponse struct {
 	NextPage *nextPage    `json:"next_page"`
 }
 
-func (c *Client) InWorkspace(name string) (*WorkspaceClient, error) {
-	wrk, err := c.GetWorkspaceByName(name)
+func (c *Client) InWorkspace(ctx context.Context, name string) (*WorkspaceClient, error) {
+	wrk, err := c.GetWorkspaceByName(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -22,18 +23,29 @@ func (c *Client) InWorkspace(name string) (*WorkspaceClient, error) {
 	return &WorkspaceClient{
 		client:          c,
 		workspace:       wrk,
-		rateLimitSearch: NewRateLimitPerMinute(60, 60),
+		rateLimitSearch: c.getLimits().search(wrk),
 	}, nil
 }
 
-func (c *Client) GetWorkspaces() ([]*Workspace, error) {
+func (c *Client) GetWorkspaces(ctx context.Context) ([]*Workspace, error) {
+	wrks, err := c.cache.getOrFetch(ctx, "workspaces", c.cache.ttls().Workspaces, func() (interface{}, error) {
+		return c.fetchWorkspaces(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wrks.([]*Workspace), nil
+}
+
+func (c *Client) fetchWorkspaces(ctx context.Context) ([]*Workspace, error) {
 	ret := []*Workspace{}
 
 	values := &url.Values{}
 
 	for {
 		resp := &workspacesResponse{}
-		err := c.get("workspaces", values, resp)
+		err := c.get(ctx, "workspaces", values, resp)
 		if err != nil {
 			return nil, err
 		}
@@ -50,8 +62,31 @@ func (c *Client) GetWorkspaces() ([]*Workspace, error) {
 	return ret, nil
 }
 
-func (c *Client) GetWorkspaceByName(name string) (*Workspace, error) {
-	wrks, err := c.GetWorkspaces()
+func (c *Client) GetWorkspaceByName(ctx context.Context, name string) (*Workspace, error) {
+	wrk, err := c.findWorkspaceByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if wrk == nil {
+		// Maybe our cached list is stale
+		c.cache.invalidate("workspaces")
+
+		wrk, err = c.findWorkspaceByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if wrk == nil {
+		return nil, fmt.Errorf("Workspace `%s` not found", name)
+	}
+
+	return wrk, nil
+}
+
+func (c *Client) findWorkspaceByName(ctx context.Context, name string) (*Workspace, error) {
+	wrks, err := c.GetWorkspaces(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +97,7 @@ func (c *Client) GetWorkspaceByName(name string) (*Workspace, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("Workspace `%s` not found", name)
+	return nil, nil
 }
 
 func (wrk *Workspace) String() string {
@@ -1,20 +1,39 @@
 package headers
 
+import "context"
 import "net/http"
+import "sync"
 
 type Headers struct {
-	header http.Header
 	rt     http.RoundTripper
+	shared *shared
 }
 
+// ResponseCallback sees every response, before the caller does
+type ResponseCallback func(*http.Request, *http.Response)
+
+// shared is the state common to all copies of a Headers, which may be
+// changed while requests are in flight
+type shared struct {
+	mu        sync.Mutex
+	header    http.Header
+	callbacks []ResponseCallback
+}
+
+type contextKey int
+
+const headerKey contextKey = iota
+
 func NewHeaders(c *http.Client) Headers {
 	if c.Transport == nil {
 		c.Transport = http.DefaultTransport
 	}
 
 	ret := Headers{
-		header: http.Header{},
-		rt:     c.Transport,
+		rt: c.Transport,
+		shared: &shared{
+			header: http.Header{},
+		},
 	}
 
 	c.Transport = ret
@@ -23,15 +42,75 @@ func NewHeaders(c *http.Client) Headers {
 }
 
 func (h *Headers) Add(key, value string) {
-	h.header.Add(key, value)
+	h.shared.mu.Lock()
+	defer h.shared.mu.Unlock()
+
+	h.shared.header.Add(key, value)
+}
+
+// Set replaces any existing values for key
+func (h *Headers) Set(key, value string) {
+	h.shared.mu.Lock()
+	defer h.shared.mu.Unlock()
+
+	h.shared.header.Set(key, value)
+}
+
+func (h *Headers) Del(key string) {
+	h.shared.mu.Lock()
+	defer h.shared.mu.Unlock()
+
+	h.shared.header.Del(key)
+}
+
+func (h *Headers) OnResponse(cb ResponseCallback) {
+	h.shared.mu.Lock()
+	defer h.shared.mu.Unlock()
+
+	h.shared.callbacks = append(h.shared.callbacks, cb)
+}
+
+// WithHeader returns a context that sets key on requests made with it,
+// replacing any per-client value
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	header := FromContext(ctx).Clone()
+	header.Set(key, value)
+
+	return context.WithValue(ctx, headerKey, header)
+}
+
+// FromContext returns the per-request headers set by WithHeader
+func FromContext(ctx context.Context) http.Header {
+	header, ok := ctx.Value(headerKey).(http.Header)
+	if !ok {
+		return http.Header{}
+	}
+
+	return header
 }
 
 func (h Headers) RoundTrip(req *http.Request) (*http.Response, error) {
-	for key, vals := range h.header {
+	h.shared.mu.Lock()
+	for key, vals := range h.shared.header {
 		for _, val := range vals {
 			req.Header.Add(key, val)
 		}
 	}
+	callbacks := h.shared.callbacks
+	h.shared.mu.Unlock()
+
+	for key, vals := range FromContext(req.Context()) {
+		req.Header[key] = append([]string{}, vals...)
+	}
+
+	resp, err := h.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cb := range callbacks {
+		cb(req, resp)
+	}
 
-	return h.rt.RoundTrip(req)
+	return resp, nil
 }
@@ -3,6 +3,8 @@ package main
 import . "github.com/firestuff/automana/rules"
 
 func main() {
+	EnsureMyTasksSections("flamingcow.io", "Recently Assigned", "Today", "Meetings", "Maybe Today", "Tonight", "Upcoming", "Later", "Someday")
+
 	InWorkspace("flamingcow.io").
 		InMyTasksSections("Recently Assigned", "Meetings", "Tonight", "Upcoming", "Later", "Someday").
 		OnlyIncomplete().
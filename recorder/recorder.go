@@ -0,0 +1,555 @@
+// Package recorder is an http.RoundTripper that records interactions to a
+// cassette file and replays them offline, for turning real Asana behavior
+// into deterministic tests.
+package recorder
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "io/ioutil"
+import "net/http"
+import "net/url"
+import "os"
+import "regexp"
+import "sort"
+import "strings"
+import "sync"
+
+type Mode int
+
+const (
+	// Record sends requests upstream and saves each interaction
+	Record Mode = iota
+
+	// Replay answers from the cassette and never touches the network
+	Replay
+)
+
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  *Request  `json:"request"`
+	Response *Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query"`
+	Body   string `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+type Recorder struct {
+	rt   http.RoundTripper
+	mode Mode
+	path string
+
+	mu          sync.Mutex
+	cassette    *Cassette
+	used        []bool
+	ignoreQuery map[string]bool
+	redactions  []*redaction
+	emails      map[string]string
+	values      map[string]string
+	counts      map[string]int
+	kept        map[string]bool
+}
+
+type redaction struct {
+	secret      string
+	replacement string
+}
+
+var emailRE = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// JSON string fields that always hold user content, by placeholder label
+var redactedFields = map[string]string{
+	"notes":      "Notes",
+	"html_notes": "Notes",
+	"text":       "Text",
+	"html_text":  "Text",
+}
+
+// Kinds of object whose "name" is redacted. Other names (sections,
+// projects, tags, custom fields) are kept, since rules look them up.
+var redactedNames = map[string]string{
+	"task":      "Task",
+	"user":      "User",
+	"workspace": "Workspace",
+}
+
+// Kind of the object under a JSON key, where it differs from its parent's
+var kindOfKey = map[string]string{
+	"assignee":     "user",
+	"created_by":   "user",
+	"followers":    "user",
+	"user":         "user",
+	"workspace":    "workspace",
+	"parent":       "task",
+	"subtasks":     "task",
+	"task":         "task",
+	"dependencies": "task",
+	"dependents":   "task",
+}
+
+// Kind of the top-level data, by the last path segment that isn't an ID
+var kindOfPath = map[string]string{
+	"tasks":      "task",
+	"search":     "task",
+	"subtasks":   "task",
+	"users":      "user",
+	"workspaces": "workspace",
+}
+
+// Request headers (including Authorization) aren't recorded at all; these
+// response headers aren't either. Content-Length changes with redaction.
+var droppedHeaders = []string{
+	"Content-Length",
+	"Set-Cookie",
+}
+
+// New wraps c's transport. In Replay mode the cassette at path must
+// exist; in Record mode it is (re)written after every interaction.
+//
+// In Replay mode the wrapped transport never runs, so anything it does
+// per request (e.g. headers.OnResponse callbacks) doesn't happen.
+func New(c *http.Client, path string, mode Mode) (*Recorder, error) {
+	if c.Transport == nil {
+		c.Transport = http.DefaultTransport
+	}
+
+	r := &Recorder{
+		rt:          c.Transport,
+		mode:        mode,
+		path:        path,
+		cassette:    &Cassette{},
+		ignoreQuery: map[string]bool{},
+		emails:      map[string]string{},
+		values:      map[string]string{},
+		counts:      map[string]int{},
+		kept:        map[string]bool{},
+	}
+
+	if mode == Replay {
+		err := r.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.Transport = r
+
+	return r, nil
+}
+
+// IgnoreQueryParams excludes params from matching, e.g. dates computed from
+// the current time
+func (r *Recorder) IgnoreQueryParams(params ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, param := range params {
+		r.ignoreQuery[param] = true
+	}
+}
+
+// Redact replaces secret with replacement in everything recorded, and in
+// requests before matching them during replay. Email addresses, notes,
+// story text and the names of tasks, users and workspaces in JSON bodies
+// are always replaced with placeholders.
+func (r *Recorder) Redact(secret, replacement string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.redactions = append(r.redactions, &redaction{
+		secret:      secret,
+		replacement: replacement,
+	})
+}
+
+// Keep exempts values from placeholder replacement, e.g. a workspace name
+// that rules look up
+func (r *Recorder) Keep(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, value := range values {
+		r.kept[value] = true
+	}
+}
+
+// Unused returns the recorded requests that replay never matched
+func (r *Recorder) Unused() []*Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ret := []*Request{}
+
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] {
+			ret = append(ret, interaction.Request)
+		}
+	}
+
+	return ret
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody := []byte{}
+
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	if r.mode == Replay {
+		return r.replay(req, reqBody)
+	}
+
+	return r.record(req, reqBody)
+}
+
+func (r *Recorder) record(req *http.Request, reqBody []byte) (*http.Response, error) {
+	resp, err := r.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	header := http.Header{}
+	for key, vals := range resp.Header {
+		for _, val := range vals {
+			header.Add(key, r.redact(val))
+		}
+	}
+
+	for _, key := range droppedHeaders {
+		header.Del(key)
+	}
+
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request: r.newRequest(req, reqBody),
+		Response: &Response{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       r.redactBody(req.URL.Path, respBody),
+		},
+	})
+	r.used = append(r.used, true)
+
+	err = r.save()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, reqBody []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	target := r.newRequest(req, reqBody)
+
+	// Prefer the first unused match, so sequences of changing responses
+	// replay in order; GETs may reuse their last match
+	found := -1
+
+	for i, interaction := range r.cassette.Interactions {
+		if !r.matches(interaction.Request, target) {
+			continue
+		}
+
+		if !r.used[i] {
+			found = i
+			break
+		}
+
+		if target.Method == "GET" {
+			found = i
+		}
+	}
+
+	if found == -1 {
+		return nil, fmt.Errorf("recorder: no recorded response for %s %s?%s in %s", target.Method, target.Path, target.Query, r.path)
+	}
+
+	r.used[found] = true
+	recorded := r.cassette.Interactions[found].Response
+
+	header := http.Header{}
+	for key, vals := range recorded.Header {
+		header[key] = append([]string{}, vals...)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Must be called with r.mu already locked
+func (r *Recorder) newRequest(req *http.Request, body []byte) *Request {
+	return &Request{
+		Method: req.Method,
+		Path:   r.redact(req.URL.Path),
+		Query:  r.normalizeQuery(req.URL.RawQuery),
+		Body:   r.redactBody(req.URL.Path, body),
+	}
+}
+
+// Must be called with r.mu already locked
+func (r *Recorder) matches(recorded, target *Request) bool {
+	return recorded.Method == target.Method &&
+		recorded.Path == target.Path &&
+		r.filterQuery(recorded.Query) == r.filterQuery(target.Query)
+}
+
+// Must be called with r.mu already locked
+func (r *Recorder) filterQuery(query string) string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return query
+	}
+
+	for param := range r.ignoreQuery {
+		values.Del(param)
+	}
+
+	return values.Encode()
+}
+
+// Must be called with r.mu already locked
+func (r *Recorder) redact(s string) string {
+	for _, red := range r.redactions {
+		s = strings.Replace(s, red.secret, red.replacement, -1)
+	}
+
+	return emailRE.ReplaceAllStringFunc(s, func(email string) string {
+		key := strings.ToLower(email)
+		if strings.HasSuffix(key, "@example.com") {
+			// Already a placeholder, e.g. in a replayed request
+			return email
+		}
+
+		placeholder, found := r.emails[key]
+		if !found {
+			placeholder = fmt.Sprintf("user%d@example.com", len(r.emails)+1)
+			r.emails[key] = placeholder
+		}
+
+		return placeholder
+	})
+}
+
+// redactBody replaces user content in a JSON body with placeholders, then
+// applies redact
+//
+// Must be called with r.mu already locked
+func (r *Recorder) redactBody(path string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	// Keep numbers exactly as sent
+	dec.UseNumber()
+
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return r.redact(string(body))
+	}
+
+	v = r.redactJSON(v, pathKind(path))
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	err = enc.Encode(v)
+	if err != nil {
+		return r.redact(string(body))
+	}
+
+	return r.redact(strings.TrimSuffix(buf.String(), "\n"))
+}
+
+// Must be called with r.mu already locked
+func (r *Recorder) redactJSON(v interface{}, kind string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		// Batch actions carry their own path
+		if relPath, ok := val["relative_path"].(string); ok {
+			kind = pathKind(relPath)
+		}
+
+		for key, child := range val {
+			str, isString := child.(string)
+
+			label, found := redactedFields[key]
+			if !found && key == "name" {
+				label, found = redactedNames[kind]
+			}
+
+			if found && isString {
+				ph := r.placeholder(label, str)
+				if strings.HasPrefix(key, "html_") && ph != str {
+					// Still valid rich text
+					ph = fmt.Sprintf("<body>%s</body>", ph)
+				}
+
+				val[key] = ph
+				continue
+			}
+
+			childKind, found := kindOfKey[key]
+			if !found {
+				childKind = ""
+				if key == "data" {
+					childKind = kind
+				}
+			}
+
+			val[key] = r.redactJSON(child, childKind)
+		}
+
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.redactJSON(child, kind)
+		}
+	}
+
+	return v
+}
+
+// placeholder returns a stable replacement for value, e.g. "Task 3"
+//
+// Must be called with r.mu already locked
+func (r *Recorder) placeholder(label, value string) string {
+	if value == "" || r.kept[value] {
+		return value
+	}
+
+	key := label + "\x00" + value
+
+	ret, found := r.values[key]
+	if !found {
+		r.counts[label]++
+		ret = fmt.Sprintf("%s %d", label, r.counts[label])
+		r.values[key] = ret
+	}
+
+	return ret
+}
+
+func pathKind(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i := len(parts) - 1; i >= 0; i-- {
+		part := parts[i]
+		// GIDs, "me" and email addresses identify an object
+		if part == "" || part == "me" || strings.Contains(part, "@") || isNumeric(part) {
+			continue
+		}
+
+		return kindOfPath[part]
+	}
+
+	return ""
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizeQuery redacts and sorts params and their values, so matching
+// doesn't depend on the order the client happened to build them in
+//
+// Must be called with r.mu already locked
+func (r *Recorder) normalizeQuery(query string) string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return r.redact(query)
+	}
+
+	for _, vals := range values {
+		for i, val := range vals {
+			vals[i] = r.redact(val)
+		}
+		sort.Strings(vals)
+	}
+
+	return values.Encode()
+}
+
+func (r *Recorder) load() error {
+	fh, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	dec := json.NewDecoder(fh)
+	err = dec.Decode(r.cassette)
+	if err != nil {
+		return fmt.Errorf("recorder: %s: %w", r.path, err)
+	}
+
+	r.used = make([]bool, len(r.cassette.Interactions))
+
+	return nil
+}
+
+// Must be called with r.mu already locked
+func (r *Recorder) save() error {
+	buf := &bytes.Buffer{}
+
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(r.cassette)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,131 @@
+package recorder_test
+
+import "context"
+import "flag"
+import "io/ioutil"
+import "strings"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+import "github.com/firestuff/automana/recorder"
+
+var record = flag.Bool("record", false, "re-record cassettes in testdata against asanatest")
+
+// newClient returns a client recording against a fresh asanatest server
+// (populated by setup) with -record, or replaying the cassette without.
+// Call the returned func when done.
+func newClient(t *testing.T, cassette string, setup func(*asanatest.Server)) (*client.Client, *recorder.Recorder, func()) {
+	if !*record {
+		c := client.NewClientWithBaseURL("replay-token", "http://asana.invalid/")
+
+		rec, err := recorder.New(c.HTTPClient(), cassette, recorder.Replay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c, rec, func() {}
+	}
+
+	s := asanatest.NewServer()
+
+	setup(s)
+
+	c := s.Client()
+
+	rec, err := recorder.New(c.HTTPClient(), cassette, recorder.Record)
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+
+	return c, rec, s.Close
+}
+
+func TestSearchReplay(t *testing.T) {
+	cassette := "testdata/search.json"
+
+	c, rec, done := newClient(t, cassette, func(s *asanatest.Server) {
+		wrk := s.AddWorkspace("Work")
+		me := s.AddUser("Alice Example", "alice@corp.test")
+		s.SetMe(me)
+
+		utl := s.AddUserTaskList(wrk, me)
+		today := s.AddSection(utl, "Today")
+		later := s.AddSection(utl, "Later")
+
+		s.AddTask(wrk, &asanatest.Task{Name: "Secret plan", HTMLNotes: "<body>Confidential</body>", Assignee: me, Sections: []*client.Section{today}})
+		s.AddTask(wrk, &asanatest.Task{Name: "Later thing", Assignee: me, Sections: []*client.Section{later}})
+		s.AddTask(wrk, &asanatest.Task{Name: "Another secret", Assignee: me, Sections: []*client.Section{today}})
+	})
+	defer done()
+
+	rec.Keep("Work")
+
+	ctx := context.Background()
+
+	wc, err := c.InWorkspace(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	me, err := wc.GetMe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utl, err := wc.GetMyUserTaskList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secsByName, err := wc.GetSectionsByName(ctx, utl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := wc.Search(ctx, &client.SearchQuery{
+		AssigneeAny: []*client.User{me},
+		SectionsAny: []*client.Section{secsByName["Today"]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gids := []string{}
+	for _, task := range tasks {
+		gids = append(gids, task.GID)
+	}
+
+	got := strings.Join(gids, ",")
+	want := "1006,1008"
+
+	if got != want {
+		t.Errorf("tasks %s, want %s", got, want)
+	}
+
+	if !*record {
+		unused := rec.Unused()
+		if len(unused) > 0 {
+			t.Errorf("%d recorded requests unused, e.g. %s %s", len(unused), unused[0].Method, unused[0].Path)
+		}
+	}
+
+	data, err := ioutil.ReadFile(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pii := range []string{"Alice", "alice@corp.test", "Secret plan", "Another secret", "Confidential"} {
+		if strings.Contains(string(data), pii) {
+			t.Errorf("cassette contains %q", pii)
+		}
+	}
+
+	// Needed to replay rules; bodies are JSON in JSON
+	for _, kept := range []string{`\"Work\"`, `\"Today\"`} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("cassette is missing %s", kept)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package rules
+
+import "net"
+import "net/http"
+
+import "github.com/firestuff/automana/metrics"
+
+var periodicRuns = metrics.Default.Counter("automana_periodic_runs_total", "Periodic runs, by result (ok, gated or error)", "periodic", "result")
+var periodicTasksMatched = metrics.Default.Counter("automana_periodic_tasks_matched_total", "Tasks that passed every filter", "periodic")
+var periodicActions = metrics.Default.Counter("automana_periodic_actions_total", "Writes made to Asana", "periodic")
+
+// ServeMetrics exposes client and periodic metrics in Prometheus text
+// format at /metrics on listenAddr. Call it before Loop or ServeWebhooks.
+func ServeMetrics(listenAddr string) error {
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+
+	go http.Serve(listener, mux)
+
+	return nil
+}
+
+// Named sets the periodic label used in metrics, which defaults to the
+// periodic's index in registration order
+func (p *periodic) Named(name string) *periodic {
+	p.name = name
+	return p
+}
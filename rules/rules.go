@@ -1,29 +1,40 @@
 package rules
 
 import "bytes"
+import "context"
 import "fmt"
 import "strings"
 import "time"
 
 import "cloud.google.com/go/civil"
 import "github.com/firestuff/automana/client"
+import "github.com/firestuff/automana/metrics"
 import "golang.org/x/net/html"
 import "golang.org/x/net/html/atom"
 
-type workspaceClientGetter func(*client.Client) (*client.WorkspaceClient, error)
-type gate func(*client.WorkspaceClient) (bool, error)
-type queryMutator func(*client.WorkspaceClient, *client.SearchQuery) error
-type taskActor func(*client.WorkspaceClient, *client.Task) error
-type taskFilter func(*client.WorkspaceClient, *client.SearchQuery, *client.Task) (bool, error)
+type workspaceClientGetter func(context.Context, *client.Client) (*client.WorkspaceClient, error)
+type gate func(context.Context, *client.WorkspaceClient) (bool, error)
+type queryMutator func(context.Context, *client.WorkspaceClient, *client.SearchQuery) error
+type taskActor func(context.Context, *client.WorkspaceClient, *client.Batch, *client.Task) error
+type taskFilter func(context.Context, *client.WorkspaceClient, *client.SearchQuery, *client.Task) (bool, error)
+type resourceGetter func(context.Context, *client.WorkspaceClient) (string, error)
 
 type periodic struct {
-	done chan bool
+	name    string
+	done    chan bool
+	trigger chan bool
+
+	// Resource GIDs whose changes should trigger this periodic, resolved
+	// from resourceGetters when serving webhooks
+	watched map[string]bool
 
 	workspaceClientGetter workspaceClientGetter
 	gates                 []gate
 	queryMutators         []queryMutator
 	taskFilters           []taskFilter
 	taskActors            []taskActor
+	sectionActors         []sectionActor
+	resourceGetters       []resourceGetter
 }
 
 type Weekday = time.Weekday
@@ -54,10 +65,28 @@ var WeekendDays = []Weekday{
 var periodics = []*periodic{}
 
 func Loop() {
+	LoopWithContext(context.Background())
+}
+
+// LoopWithContext runs all periodics until ctx is cancelled
+func LoopWithContext(ctx context.Context) {
 	c := client.NewClientFromEnv()
+	c.SetMetrics(metrics.Default, "rules")
+
+	LoopWithClient(ctx, c)
+}
+
+// LoopWithClient is LoopWithContext with a caller-supplied client, e.g.
+// one replaying a recorder cassette
+func LoopWithClient(ctx context.Context, c *client.Client) {
+	err := ensureSections(ctx, c)
+	if err != nil {
+		// Periodics will report the missing sections themselves
+		fmt.Printf("ERROR: %s\n", err)
+	}
 
 	for _, periodic := range periodics {
-		periodic.start(c)
+		periodic.start(ctx, c)
 	}
 
 	for _, periodic := range periodics {
@@ -67,9 +96,11 @@ func Loop() {
 
 func InWorkspace(name string) *periodic {
 	ret := &periodic{
-		done: make(chan bool),
-		workspaceClientGetter: func(c *client.Client) (*client.WorkspaceClient, error) {
-			return c.InWorkspace(name)
+		name:    fmt.Sprintf("%d", len(periodics)),
+		done:    make(chan bool),
+		trigger: make(chan bool, 1),
+		workspaceClientGetter: func(ctx context.Context, c *client.Client) (*client.WorkspaceClient, error) {
+			return c.InWorkspace(ctx, name)
 		},
 	}
 
@@ -80,7 +111,7 @@ func InWorkspace(name string) *periodic {
 
 // Gates
 func (p *periodic) WhenBetween(tz, start, end string) *periodic {
-	p.gates = append(p.gates, func(wc *client.WorkspaceClient) (bool, error) {
+	p.gates = append(p.gates, func(ctx context.Context, wc *client.WorkspaceClient) (bool, error) {
 		loc, err := time.LoadLocation(tz)
 		if err != nil {
 			return false, err
@@ -110,7 +141,7 @@ func (p *periodic) WhenBetween(tz, start, end string) *periodic {
 }
 
 func (p *periodic) WhenDayOfWeek(tz string, days []Weekday) *periodic {
-	p.gates = append(p.gates, func(wc *client.WorkspaceClient) (bool, error) {
+	p.gates = append(p.gates, func(ctx context.Context, wc *client.WorkspaceClient) (bool, error) {
 		loc, err := time.LoadLocation(tz)
 		if err != nil {
 			return false, err
@@ -132,20 +163,20 @@ func (p *periodic) WhenDayOfWeek(tz string, days []Weekday) *periodic {
 
 // Query mutators
 func (p *periodic) InMyTasksSections(names ...string) *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
-		u, err := wc.GetMe()
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		u, err := wc.GetMe(ctx)
 		if err != nil {
 			return err
 		}
 
 		q.AssigneeAny = append(q.AssigneeAny, u)
 
-		utl, err := wc.GetMyUserTaskList()
+		utl, err := wc.GetMyUserTaskList(ctx)
 		if err != nil {
 			return err
 		}
 
-		secsByName, err := wc.GetSectionsByName(utl)
+		secsByName, err := wc.GetSectionsByName(ctx, utl)
 		if err != nil {
 			return err
 		}
@@ -153,6 +184,7 @@ func (p *periodic) InMyTasksSections(names ...string) *periodic {
 		for _, name := range names {
 			sec, found := secsByName[name]
 			if !found {
+				wc.InvalidateSections(utl)
 				return fmt.Errorf("Section '%s' not found", name)
 			}
 
@@ -162,27 +194,22 @@ func (p *periodic) InMyTasksSections(names ...string) *periodic {
 		return nil
 	})
 
-	// Backup filter if the API misbehaves
-	// Asana issue #600801
-	p.taskFilters = append(p.taskFilters, func(wc *client.WorkspaceClient, q *client.SearchQuery, t *client.Task) (bool, error) {
-		if t.AssigneeSection == nil {
-			return false, fmt.Errorf("missing assignee: %s", t)
-		}
-
-		for _, sec := range q.SectionsAny {
-			if sec.GID == t.AssigneeSection.GID {
-				return true, nil
-			}
+	p.resourceGetters = append(p.resourceGetters, func(ctx context.Context, wc *client.WorkspaceClient) (string, error) {
+		utl, err := wc.GetMyUserTaskList(ctx)
+		if err != nil {
+			return "", err
 		}
 
-		return false, nil
+		return utl.GID, nil
 	})
 
+	p.taskFilters = append(p.taskFilters, inAssigneeSections)
+
 	return p
 }
 
 func (p *periodic) DueInDays(days int) *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
 		if q.DueOn != nil {
 			return fmt.Errorf("Multiple clauses set DueOn")
 		}
@@ -197,7 +224,7 @@ func (p *periodic) DueInDays(days int) *periodic {
 }
 
 func (p *periodic) DueInAtLeastDays(days int) *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
 		if q.DueAfter != nil {
 			return fmt.Errorf("Multiple clauses set DueAfter")
 		}
@@ -212,7 +239,7 @@ func (p *periodic) DueInAtLeastDays(days int) *periodic {
 }
 
 func (p *periodic) DueInAtMostDays(days int) *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
 		if q.DueBefore != nil {
 			return fmt.Errorf("Multiple clauses set DueBefore")
 		}
@@ -227,7 +254,7 @@ func (p *periodic) DueInAtMostDays(days int) *periodic {
 }
 
 func (p *periodic) OnlyIncomplete() *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
 		if q.Completed != nil {
 			return fmt.Errorf("Multiple clauses set Completed")
 		}
@@ -240,7 +267,7 @@ func (p *periodic) OnlyIncomplete() *periodic {
 }
 
 func (p *periodic) OnlyComplete() *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
 		if q.Completed != nil {
 			return fmt.Errorf("Multiple clauses set Completed")
 		}
@@ -253,12 +280,12 @@ func (p *periodic) OnlyComplete() *periodic {
 }
 
 func (p *periodic) WithTagsAnyOf(names ...string) *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
 		if len(q.TagsAny) > 0 {
 			return fmt.Errorf("Multiple clauses set TagsAny")
 		}
 
-		tagsByName, err := wc.GetTagsByName()
+		tagsByName, err := wc.GetTagsByName(ctx)
 		if err != nil {
 			return err
 		}
@@ -266,6 +293,7 @@ func (p *periodic) WithTagsAnyOf(names ...string) *periodic {
 		for _, name := range names {
 			tag, found := tagsByName[name]
 			if !found {
+				wc.InvalidateTags()
 				return fmt.Errorf("Tag '%s' not found", name)
 			}
 
@@ -279,12 +307,12 @@ func (p *periodic) WithTagsAnyOf(names ...string) *periodic {
 }
 
 func (p *periodic) WithoutTagsAnyOf(names ...string) *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
 		if len(q.TagsNot) > 0 {
 			return fmt.Errorf("Multiple clauses set TagsNot")
 		}
 
-		tagsByName, err := wc.GetTagsByName()
+		tagsByName, err := wc.GetTagsByName(ctx)
 		if err != nil {
 			return err
 		}
@@ -292,6 +320,7 @@ func (p *periodic) WithoutTagsAnyOf(names ...string) *periodic {
 		for _, name := range names {
 			tag, found := tagsByName[name]
 			if !found {
+				wc.InvalidateTags()
 				return fmt.Errorf("Tag '%s' not found", name)
 			}
 
@@ -304,9 +333,412 @@ func (p *periodic) WithoutTagsAnyOf(names ...string) *periodic {
 	return p
 }
 
+func (p *periodic) WithText(text string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		if q.Text != "" {
+			return fmt.Errorf("Multiple clauses set Text")
+		}
+
+		q.Text = text
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) WithResourceSubtype(subtype string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		if q.ResourceSubtype != "" {
+			return fmt.Errorf("Multiple clauses set ResourceSubtype")
+		}
+
+		q.ResourceSubtype = subtype
+		return nil
+	})
+
+	return p
+}
+
+// AssignedTo takes user GIDs or email addresses
+func (p *periodic) AssignedTo(users ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		for _, id := range users {
+			u, err := wc.GetUser(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			q.AssigneeAny = append(q.AssigneeAny, u)
+		}
+
+		return nil
+	})
+
+	return p
+}
+
+// InUserTaskListSections is InMyTasksSections for another user's My Tasks,
+// identified by GID or email address
+func (p *periodic) InUserTaskListSections(user string, names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		u, err := wc.GetUser(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		q.AssigneeAny = append(q.AssigneeAny, u)
+
+		utl, err := wc.GetUserTaskList(ctx, u)
+		if err != nil {
+			return err
+		}
+
+		secs, err := sectionsByNames(ctx, wc, utl, names)
+		if err != nil {
+			return err
+		}
+
+		q.SectionsAny = append(q.SectionsAny, secs...)
+		return nil
+	})
+
+	p.resourceGetters = append(p.resourceGetters, func(ctx context.Context, wc *client.WorkspaceClient) (string, error) {
+		u, err := wc.GetUser(ctx, user)
+		if err != nil {
+			return "", err
+		}
+
+		utl, err := wc.GetUserTaskList(ctx, u)
+		if err != nil {
+			return "", err
+		}
+
+		return utl.GID, nil
+	})
+
+	p.taskFilters = append(p.taskFilters, inAssigneeSections)
+
+	return p
+}
+
+func (p *periodic) NotAssignedToMe() *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		u, err := wc.GetMe(ctx)
+		if err != nil {
+			return err
+		}
+
+		q.AssigneeNot = append(q.AssigneeNot, u)
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) FollowedByMe() *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		u, err := wc.GetMe(ctx)
+		if err != nil {
+			return err
+		}
+
+		q.FollowersAny = append(q.FollowersAny, u)
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) InProjectsAnyOf(names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		if len(q.ProjectsAny) > 0 {
+			return fmt.Errorf("Multiple clauses set ProjectsAny")
+		}
+
+		projects, err := projectsByNames(ctx, wc, names)
+		if err != nil {
+			return err
+		}
+
+		q.ProjectsAny = projects
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) InProjectsAllOf(names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		if len(q.ProjectsAll) > 0 {
+			return fmt.Errorf("Multiple clauses set ProjectsAll")
+		}
+
+		projects, err := projectsByNames(ctx, wc, names)
+		if err != nil {
+			return err
+		}
+
+		q.ProjectsAll = projects
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) NotInProjectsAnyOf(names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		if len(q.ProjectsNot) > 0 {
+			return fmt.Errorf("Multiple clauses set ProjectsNot")
+		}
+
+		projects, err := projectsByNames(ctx, wc, names)
+		if err != nil {
+			return err
+		}
+
+		q.ProjectsNot = projects
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) NotInMyTasksSections(names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		utl, err := wc.GetMyUserTaskList(ctx)
+		if err != nil {
+			return err
+		}
+
+		secs, err := sectionsByNames(ctx, wc, utl, names)
+		if err != nil {
+			return err
+		}
+
+		q.SectionsNot = append(q.SectionsNot, secs...)
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) InProjectSectionsAnyOf(project string, names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		secs, err := projectSectionsByNames(ctx, wc, project, names)
+		if err != nil {
+			return err
+		}
+
+		q.SectionsAny = append(q.SectionsAny, secs...)
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) InProjectSectionsAllOf(project string, names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		secs, err := projectSectionsByNames(ctx, wc, project, names)
+		if err != nil {
+			return err
+		}
+
+		q.SectionsAll = append(q.SectionsAll, secs...)
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) NotInProjectSections(project string, names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		secs, err := projectSectionsByNames(ctx, wc, project, names)
+		if err != nil {
+			return err
+		}
+
+		q.SectionsNot = append(q.SectionsNot, secs...)
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) WithTagsAllOf(names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		if len(q.TagsAll) > 0 {
+			return fmt.Errorf("Multiple clauses set TagsAll")
+		}
+
+		tags, err := tagsByNames(ctx, wc, names)
+		if err != nil {
+			return err
+		}
+
+		q.TagsAll = tags
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) InTeamsAnyOf(names ...string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		if len(q.TeamsAny) > 0 {
+			return fmt.Errorf("Multiple clauses set TeamsAny")
+		}
+
+		teamsByName, err := wc.GetTeamsByName(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			team, found := teamsByName[name]
+			if !found {
+				wc.InvalidateTeams()
+				return fmt.Errorf("Team '%s' not found", name)
+			}
+
+			q.TeamsAny = append(q.TeamsAny, team)
+		}
+
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) OnlyBlocked() *periodic {
+	return p.setBool("IsBlocked", func(q *client.SearchQuery) **bool { return &q.IsBlocked }, client.TRUE)
+}
+
+func (p *periodic) OnlyUnblocked() *periodic {
+	return p.setBool("IsBlocked", func(q *client.SearchQuery) **bool { return &q.IsBlocked }, client.FALSE)
+}
+
+func (p *periodic) OnlyBlocking() *periodic {
+	return p.setBool("IsBlocking", func(q *client.SearchQuery) **bool { return &q.IsBlocking }, client.TRUE)
+}
+
+func (p *periodic) OnlyNotBlocking() *periodic {
+	return p.setBool("IsBlocking", func(q *client.SearchQuery) **bool { return &q.IsBlocking }, client.FALSE)
+}
+
+func (p *periodic) WithAttachment() *periodic {
+	return p.setBool("HasAttachment", func(q *client.SearchQuery) **bool { return &q.HasAttachment }, client.TRUE)
+}
+
+func (p *periodic) WithoutAttachment() *periodic {
+	return p.setBool("HasAttachment", func(q *client.SearchQuery) **bool { return &q.HasAttachment }, client.FALSE)
+}
+
+func (p *periodic) OnlySubtasks() *periodic {
+	return p.setBool("IsSubtask", func(q *client.SearchQuery) **bool { return &q.IsSubtask }, client.TRUE)
+}
+
+func (p *periodic) StartsInAtLeastDays(days int) *periodic {
+	return p.setDate("StartOnAfter", func(q *client.SearchQuery) **civil.Date { return &q.StartOnAfter }, days)
+}
+
+func (p *periodic) StartsInAtMostDays(days int) *periodic {
+	return p.setDate("StartOnBefore", func(q *client.SearchQuery) **civil.Date { return &q.StartOnBefore }, days)
+}
+
+func (p *periodic) DueAtInAtLeastHours(hours int) *periodic {
+	return p.setTime("DueAtAfter", func(q *client.SearchQuery) **time.Time { return &q.DueAtAfter }, time.Duration(hours)*time.Hour)
+}
+
+func (p *periodic) DueAtInAtMostHours(hours int) *periodic {
+	return p.setTime("DueAtBefore", func(q *client.SearchQuery) **time.Time { return &q.DueAtBefore }, time.Duration(hours)*time.Hour)
+}
+
+func (p *periodic) CreatedAtLeastDaysAgo(days int) *periodic {
+	return p.setTime("CreatedAtBefore", func(q *client.SearchQuery) **time.Time { return &q.CreatedAtBefore }, daysAgo(days))
+}
+
+func (p *periodic) CreatedAtMostDaysAgo(days int) *periodic {
+	return p.setTime("CreatedAtAfter", func(q *client.SearchQuery) **time.Time { return &q.CreatedAtAfter }, daysAgo(days))
+}
+
+func (p *periodic) ModifiedAtLeastDaysAgo(days int) *periodic {
+	return p.setTime("ModifiedAtBefore", func(q *client.SearchQuery) **time.Time { return &q.ModifiedAtBefore }, daysAgo(days))
+}
+
+func (p *periodic) ModifiedAtMostDaysAgo(days int) *periodic {
+	return p.setTime("ModifiedAtAfter", func(q *client.SearchQuery) **time.Time { return &q.ModifiedAtAfter }, daysAgo(days))
+}
+
+func (p *periodic) CompletedAtLeastDaysAgo(days int) *periodic {
+	return p.setTime("CompletedAtBefore", func(q *client.SearchQuery) **time.Time { return &q.CompletedAtBefore }, daysAgo(days))
+}
+
+func (p *periodic) CompletedAtMostDaysAgo(days int) *periodic {
+	return p.setTime("CompletedAtAfter", func(q *client.SearchQuery) **time.Time { return &q.CompletedAtAfter }, daysAgo(days))
+}
+
+// WithCustomFieldValue matches tasks whose custom field named field has
+// value: text, a number, or a user GID for people fields. Use
+// WithCustomFieldEnum for enums.
+func (p *periodic) WithCustomFieldValue(field, value string) *periodic {
+	return p.addCustomFieldQuery(field, &client.CustomFieldQuery{
+		Value: &value,
+	})
+}
+
+// WithCustomFieldEnum matches tasks whose enum (or multi_enum) custom field
+// named field has the option named option
+func (p *periodic) WithCustomFieldEnum(field, option string) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		cf, err := wc.GetCustomFieldByName(ctx, field)
+		if err != nil {
+			return err
+		}
+
+		opt, err := cf.EnumOptionByName(option)
+		if err != nil {
+			wc.InvalidateCustomFields()
+			return err
+		}
+
+		q.CustomFields = append(q.CustomFields, &client.CustomFieldQuery{
+			GID:   cf.GID,
+			Value: &opt.GID,
+		})
+
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) WithCustomFieldLessThan(field string, value float64) *periodic {
+	return p.addCustomFieldQuery(field, &client.CustomFieldQuery{
+		LessThan: &value,
+	})
+}
+
+func (p *periodic) WithCustomFieldGreaterThan(field string, value float64) *periodic {
+	return p.addCustomFieldQuery(field, &client.CustomFieldQuery{
+		GreaterThan: &value,
+	})
+}
+
+func (p *periodic) WithCustomFieldSet(field string) *periodic {
+	return p.addCustomFieldQuery(field, &client.CustomFieldQuery{
+		IsSet: client.TRUE,
+	})
+}
+
+func (p *periodic) WithoutCustomFieldSet(field string) *periodic {
+	return p.addCustomFieldQuery(field, &client.CustomFieldQuery{
+		IsSet: client.FALSE,
+	})
+}
+
 // Task filters
 func (p *periodic) WithUnlinkedURL() *periodic {
-	p.taskFilters = append(p.taskFilters, func(wc *client.WorkspaceClient, _ *client.SearchQuery, t *client.Task) (bool, error) {
+	p.taskFilters = append(p.taskFilters, func(ctx context.Context, wc *client.WorkspaceClient, _ *client.SearchQuery, t *client.Task) (bool, error) {
 		return hasUnlinkedURL(t.ParsedHTMLNotes), nil
 	})
 
@@ -314,7 +746,7 @@ func (p *periodic) WithUnlinkedURL() *periodic {
 }
 
 func (p *periodic) WithoutDue() *periodic {
-	p.queryMutators = append(p.queryMutators, func(wc *client.WorkspaceClient, q *client.SearchQuery) error {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
 		if q.Due != nil {
 			return fmt.Errorf("Multiple clauses set Due")
 		}
@@ -330,7 +762,7 @@ func (p *periodic) WithoutDue() *periodic {
 
 // Task actors
 func (p *periodic) FixUnlinkedURL() *periodic {
-	p.taskActors = append(p.taskActors, func(wc *client.WorkspaceClient, t *client.Task) error {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
 		fixUnlinkedURL(t.ParsedHTMLNotes)
 
 		buf := &bytes.Buffer{}
@@ -341,38 +773,162 @@ func (p *periodic) FixUnlinkedURL() *periodic {
 		}
 
 		notes := buf.String()
+		notes = strings.TrimSuffix(strings.TrimPrefix(notes, "<html><head></head>"), "</html>")
+
+		batch.UpdateTask(t, client.NewTaskPatch().SetHTMLNotes(notes))
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) MoveToMyTasksSection(name string) *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		utl, err := wc.GetMyUserTaskList(ctx)
+		if err != nil {
+			return err
+		}
+
+		sec, err := wc.GetSectionByName(ctx, utl, name)
+		if err != nil {
+			return err
+		}
+
+		batch.AddTaskToSection(t, sec)
+		return nil
+	})
+
+	return p
+}
 
-		update := &client.Task{
-			GID:       t.GID,
-			HTMLNotes: strings.TrimSuffix(strings.TrimPrefix(notes, "<html><head></head>"), "</html>"),
+func (p *periodic) AddTag(name string) *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		tag, err := tagByName(ctx, wc, name)
+		if err != nil {
+			return err
+		}
+
+		if !hasTag(t, tag) {
+			batch.AddTag(t, tag)
 		}
 
-		return wc.UpdateTask(update)
+		return nil
 	})
 
 	return p
 }
 
-func (p *periodic) MoveToMyTasksSection(name string) *periodic {
-	p.taskActors = append(p.taskActors, func(wc *client.WorkspaceClient, t *client.Task) error {
-		utl, err := wc.GetMyUserTaskList()
+// RemoveTag is typically used to consume a hint tag once a rule has acted
+// on it
+func (p *periodic) RemoveTag(name string) *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		tag, err := tagByName(ctx, wc, name)
+		if err != nil {
+			return err
+		}
+
+		if hasTag(t, tag) {
+			batch.RemoveTag(t, tag)
+		}
+
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) AddToProject(name string) *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		projects, err := projectsByNames(ctx, wc, []string{name})
+		if err != nil {
+			return err
+		}
+
+		if !inProject(t, projects[0]) {
+			batch.AddProject(t, projects[0])
+		}
+
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) RemoveFromProject(name string) *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		projects, err := projectsByNames(ctx, wc, []string{name})
+		if err != nil {
+			return err
+		}
+
+		if inProject(t, projects[0]) {
+			batch.RemoveProject(t, projects[0])
+		}
+
+		return nil
+	})
+
+	return p
+}
+
+// AddFollowers takes user GIDs, email addresses or "me"
+func (p *periodic) AddFollowers(users ...string) *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		followers := []*client.User{}
+		for _, user := range users {
+			followers = append(followers, &client.User{GID: user})
+		}
+
+		batch.AddFollowers(t, followers)
+		return nil
+	})
+
+	return p
+}
+
+func (p *periodic) Complete() *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		batch.UpdateTask(t, client.NewTaskPatch().SetCompleted(true))
+		return nil
+	})
+
+	return p
+}
+
+// SetCustomField sets the custom field named field; see
+// client.CustomField.EncodeValue for the accepted value types. A nil value
+// clears the field.
+func (p *periodic) SetCustomField(field string, value interface{}) *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		cf, err := wc.GetCustomFieldByName(ctx, field)
 		if err != nil {
 			return err
 		}
 
-		sec, err := wc.GetSectionByName(utl, name)
+		encoded, err := cf.EncodeValue(value)
 		if err != nil {
 			return err
 		}
 
-		return wc.AddTaskToSection(t, sec)
+		batch.UpdateTask(t, client.NewTaskPatch().SetCustomField(cf.GID, encoded))
+		return nil
+	})
+
+	return p
+}
+
+// Comment leaves a comment on each task, e.g. to explain what the rule did
+func (p *periodic) Comment(htmlText string) *periodic {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
+		batch.AddComment(t, htmlText)
+		return nil
 	})
 
 	return p
 }
 
 func (p *periodic) PrintTasks() *periodic {
-	p.taskActors = append(p.taskActors, func(wc *client.WorkspaceClient, t *client.Task) error {
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, t *client.Task) error {
 		fmt.Printf("%s\n", t)
 		return nil
 	})
@@ -381,13 +937,13 @@ func (p *periodic) PrintTasks() *periodic {
 }
 
 // Infra
-func (p *periodic) start(client *client.Client) {
+func (p *periodic) start(ctx context.Context, client *client.Client) {
 	err := p.validate()
 	if err != nil {
 		panic(err)
 	}
 
-	go p.loop(client)
+	go p.loop(ctx, client)
 }
 
 func (p *periodic) validate() error {
@@ -398,10 +954,10 @@ func (p *periodic) wait() {
 	<-p.done
 }
 
-func (p *periodic) loop(client *client.Client) {
-	for {
-		err := p.exec(client)
-		if err != nil {
+func (p *periodic) loop(ctx context.Context, client *client.Client) {
+	for ctx.Err() == nil {
+		err := p.exec(ctx, client)
+		if err != nil && ctx.Err() == nil {
 			fmt.Printf("ERROR: %s\n", err)
 			// continue
 		}
@@ -410,43 +966,96 @@ func (p *periodic) loop(client *client.Client) {
 	close(p.done)
 }
 
-func (p *periodic) exec(c *client.Client) error {
-	wc, err := p.workspaceClientGetter(c)
+func (p *periodic) exec(ctx context.Context, c *client.Client) error {
+	ran, err := p.run(ctx, c)
+
+	switch {
+	case err != nil:
+		periodicRuns.Inc(p.name, "error")
+	case !ran:
+		periodicRuns.Inc(p.name, "gated")
+	default:
+		periodicRuns.Inc(p.name, "ok")
+	}
+
+	return err
+}
+
+// run returns false if a gate stopped it
+func (p *periodic) run(ctx context.Context, c *client.Client) (bool, error) {
+	wc, err := p.workspaceClientGetter(ctx, c)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	for _, g := range p.gates {
-		ok, err := g(wc)
+		ok, err := g(ctx, wc)
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		if !ok {
-			return nil
+			return false, nil
+		}
+	}
+
+	if len(p.taskActors) > 0 {
+		err = p.execTasks(ctx, wc)
+		if err != nil {
+			return true, err
 		}
 	}
 
+	for _, act := range p.sectionActors {
+		err = act(ctx, wc)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+func (p *periodic) execTasks(ctx context.Context, wc *client.WorkspaceClient) error {
 	q := &client.SearchQuery{}
 
+	var err error
+
 	for _, mut := range p.queryMutators {
-		err = mut(wc, q)
+		err = mut(ctx, wc, q)
 		if err != nil {
 			return err
 		}
 	}
 
-	tasks, err := wc.Search(q)
+	// Writes are collected and sent together
+	batch := wc.Batch()
+
+	err = p.actOnTasks(ctx, wc, q, batch)
+
+	// Writes queued for earlier tasks still stand if a later one fails
+	flushErr := p.executeBatch(ctx, batch)
+
+	if err != nil && flushErr != nil {
+		return client.MultiError{err, flushErr}
+	}
+
 	if err != nil {
 		return err
 	}
 
-	filteredTasks := []*client.Task{}
-	for _, task := range tasks {
+	return flushErr
+}
+
+func (p *periodic) actOnTasks(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery, batch *client.Batch) error {
+	// Act on tasks as they stream in, rather than waiting for all pages
+	it := wc.SearchIter(q, 0)
+	for it.Next(ctx) {
+		task := it.Task()
 		included := true
 
 		for _, filter := range p.taskFilters {
-			include, err := filter(wc, q, task)
+			include, err := filter(ctx, wc, q, task)
 			if err != nil {
 				return err
 			}
@@ -457,20 +1066,53 @@ func (p *periodic) exec(c *client.Client) error {
 			}
 		}
 
-		if included {
-			filteredTasks = append(filteredTasks, task)
+		if !included {
+			continue
 		}
-	}
 
-	for _, task := range filteredTasks {
+		periodicTasksMatched.Inc(p.name)
+
 		for _, act := range p.taskActors {
-			err = act(wc, task)
+			err := act(ctx, wc, batch, task)
+			if err != nil {
+				return err
+			}
+		}
+
+		if batch.Ready() {
+			err := p.executeBatch(ctx, batch)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
+	return it.Err()
+}
+
+// executeBatch returns every failed action, not just the first
+func (p *periodic) executeBatch(ctx context.Context, batch *client.Batch) error {
+	results, err := batch.Execute(ctx)
+
+	errs := client.MultiError{}
+
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+			continue
+		}
+
+		periodicActions.Inc(p.name)
+	}
+
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
 	return nil
 }
 
@@ -578,6 +1220,192 @@ func nodeHasUnlinkedURL(node *html.Node) bool {
 	return false
 }
 
+func (p *periodic) setBool(name string, field func(*client.SearchQuery) **bool, val *bool) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		f := field(q)
+		if *f != nil {
+			return fmt.Errorf("Multiple clauses set %s", name)
+		}
+
+		*f = val
+		return nil
+	})
+
+	return p
+}
+
+// setDate sets a date field to today plus days
+func (p *periodic) setDate(name string, field func(*client.SearchQuery) **civil.Date, days int) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		f := field(q)
+		if *f != nil {
+			return fmt.Errorf("Multiple clauses set %s", name)
+		}
+
+		d := civil.DateOf(time.Now())
+		d = d.AddDays(days)
+		*f = &d
+		return nil
+	})
+
+	return p
+}
+
+// setTime sets a time field to now plus offset
+func (p *periodic) setTime(name string, field func(*client.SearchQuery) **time.Time, offset time.Duration) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		f := field(q)
+		if *f != nil {
+			return fmt.Errorf("Multiple clauses set %s", name)
+		}
+
+		t := time.Now().Add(offset)
+		*f = &t
+		return nil
+	})
+
+	return p
+}
+
+// addCustomFieldQuery adds cfq for the custom field named field
+func (p *periodic) addCustomFieldQuery(field string, cfq *client.CustomFieldQuery) *periodic {
+	p.queryMutators = append(p.queryMutators, func(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery) error {
+		cf, err := wc.GetCustomFieldByName(ctx, field)
+		if err != nil {
+			return err
+		}
+
+		resolved := *cfq
+		resolved.GID = cf.GID
+
+		q.CustomFields = append(q.CustomFields, &resolved)
+		return nil
+	})
+
+	return p
+}
+
+func projectsByNames(ctx context.Context, wc *client.WorkspaceClient, names []string) ([]*client.Project, error) {
+	projectsByName, err := wc.GetProjectsByName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*client.Project{}
+
+	for _, name := range names {
+		project, found := projectsByName[name]
+		if !found {
+			wc.InvalidateProjects()
+			return nil, fmt.Errorf("Project '%s' not found", name)
+		}
+
+		ret = append(ret, project)
+	}
+
+	return ret, nil
+}
+
+func sectionsByNames(ctx context.Context, wc *client.WorkspaceClient, project *client.Project, names []string) ([]*client.Section, error) {
+	secsByName, err := wc.GetSectionsByName(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*client.Section{}
+
+	for _, name := range names {
+		sec, found := secsByName[name]
+		if !found {
+			wc.InvalidateSections(project)
+			return nil, fmt.Errorf("Section '%s' not found", name)
+		}
+
+		ret = append(ret, sec)
+	}
+
+	return ret, nil
+}
+
+// Backup filter for user task list sections if the API misbehaves
+// Asana issue #600801
+func inAssigneeSections(ctx context.Context, wc *client.WorkspaceClient, q *client.SearchQuery, t *client.Task) (bool, error) {
+	if t.AssigneeSection == nil {
+		return false, fmt.Errorf("missing assignee: %s", t)
+	}
+
+	for _, sec := range q.SectionsAny {
+		if sec.GID == t.AssigneeSection.GID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func projectSectionsByNames(ctx context.Context, wc *client.WorkspaceClient, project string, names []string) ([]*client.Section, error) {
+	projects, err := projectsByNames(ctx, wc, []string{project})
+	if err != nil {
+		return nil, err
+	}
+
+	return sectionsByNames(ctx, wc, projects[0], names)
+}
+
+func tagsByNames(ctx context.Context, wc *client.WorkspaceClient, names []string) ([]*client.Tag, error) {
+	tagsByName, err := wc.GetTagsByName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*client.Tag{}
+
+	for _, name := range names {
+		tag, found := tagsByName[name]
+		if !found {
+			wc.InvalidateTags()
+			return nil, fmt.Errorf("Tag '%s' not found", name)
+		}
+
+		ret = append(ret, tag)
+	}
+
+	return ret, nil
+}
+
+func tagByName(ctx context.Context, wc *client.WorkspaceClient, name string) (*client.Tag, error) {
+	tags, err := tagsByNames(ctx, wc, []string{name})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags[0], nil
+}
+
+func hasTag(t *client.Task, tag *client.Tag) bool {
+	for _, existing := range t.Tags {
+		if existing.GID == tag.GID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func inProject(t *client.Task, project *client.Project) bool {
+	for _, existing := range t.Projects {
+		if existing.GID == project.GID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func daysAgo(days int) time.Duration {
+	return -time.Duration(days) * 24 * time.Hour
+}
+
 func timeBefore(t1, t2 civil.Time) bool {
 	return ((t1.Hour < t2.Hour) ||
 		(t1.Hour == t2.Hour && t1.Minute < t2.Minute) ||
@@ -0,0 +1,455 @@
+package rules
+
+import "context"
+import "errors"
+import "strings"
+import "testing"
+
+import "cloud.google.com/go/civil"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestInAssigneeSections(t *testing.T) {
+	q := &client.SearchQuery{
+		SectionsAny: []*client.Section{
+			{GID: "1"},
+			{GID: "2"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		task    *client.Task
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "listed section",
+			task: &client.Task{GID: "10", AssigneeSection: &client.AssigneeSection{GID: "2"}},
+			want: true,
+		},
+		{
+			name: "other section",
+			task: &client.Task{GID: "11", AssigneeSection: &client.AssigneeSection{GID: "3"}},
+			want: false,
+		},
+		{
+			name:    "unassigned",
+			task:    &client.Task{GID: "12"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := inAssigneeSections(context.Background(), nil, q, test.task)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %t", err, test.wantErr)
+			}
+
+			if got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExecTasksFlushesOnError(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	wrk := s.AddWorkspace("Work")
+	s.AddTag(wrk, "Done")
+
+	// Created, and so searched, in this order
+	gids := []string{}
+	for _, name := range []string{"First", "Fails", "Last"} {
+		gids = append(gids, s.AddTask(wrk, &asanatest.Task{Name: name}))
+	}
+
+	p := InWorkspace("Work").AddTag("Done")
+	defer func() { periodics = nil }()
+
+	failure := errors.New("actor failed")
+	p.taskActors = append(p.taskActors, func(ctx context.Context, wc *client.WorkspaceClient, batch *client.Batch, task *client.Task) error {
+		if task.Name == "Fails" {
+			return failure
+		}
+		return nil
+	})
+
+	_, err := p.run(context.Background(), s.Client())
+	if !errors.Is(err, failure) {
+		t.Fatalf("got %v, want %v", err, failure)
+	}
+
+	// Writes queued before the failure are sent; later tasks aren't reached
+	want := []bool{true, true, false}
+	for i, gid := range gids {
+		got := len(s.GetTask(gid).Tags) > 0
+		if got != want[i] {
+			t.Errorf("task %d tagged %t, want %t", i, got, want[i])
+		}
+	}
+}
+
+func TestExecuteBatchReturnsAllFailures(t *testing.T) {
+	s := asanatest.NewServer()
+	defer s.Close()
+
+	wrk := s.AddWorkspace("Work")
+	tag := s.AddTag(wrk, "Tag")
+	gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+
+	ctx := context.Background()
+
+	wc, err := s.Client().InWorkspace(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, actions := range []int{2, 5} {
+		batch := wc.Batch()
+		batch.AddTag(&client.Task{GID: gid}, tag)
+		for i := 1; i < actions; i++ {
+			batch.AddTag(&client.Task{GID: "missing"}, tag)
+		}
+
+		p := &periodic{name: "test"}
+
+		err = p.executeBatch(ctx, batch)
+
+		multi := client.MultiError{}
+		if !errors.As(err, &multi) {
+			t.Fatalf("%d actions: got %v, want MultiError", actions, err)
+		}
+
+		if len(multi) != actions-1 {
+			t.Errorf("%d actions: got %d errors, want %d", actions, len(multi), actions-1)
+		}
+
+		if !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("%d actions: got %v, want not found", actions, err)
+		}
+
+		if batch.Len() != 0 {
+			t.Errorf("%d actions: %d actions left in batch", actions, batch.Len())
+		}
+	}
+}
+
+func TestCustomFieldRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    func(p *periodic, me *client.User) *periodic
+		want    []string
+		wantErr bool
+	}{
+		{"text value", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldValue("Notes", "urgent") }, []string{"A"}, false},
+		{"less than", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldLessThan("Points", 3) }, []string{"A"}, false},
+		{"greater than", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldGreaterThan("Points", 3) }, []string{"B"}, false},
+		{"set", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldSet("Notes") }, []string{"A"}, false},
+		{"not set", func(p *periodic, me *client.User) *periodic { return p.WithoutCustomFieldSet("Notes") }, []string{"B", "C"}, false},
+		{"enum", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldEnum("Priority", "High") }, []string{"B"}, false},
+		{"multi_enum", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldEnum("Labels", "Red") }, []string{"C"}, false},
+		{"people", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldValue("Owner", me.GID) }, []string{"C"}, false},
+		{"unknown field", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldSet("Missing") }, nil, true},
+		{"unknown option", func(p *periodic, me *client.User) *periodic { return p.WithCustomFieldEnum("Priority", "Missing") }, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			me := s.AddUser("Me", "me@example.com")
+			s.SetMe(me)
+			s.AddTag(wrk, "Hit")
+
+			fields := []*client.CustomField{
+				{Name: "Notes", ResourceSubtype: "text"},
+				{Name: "Points", ResourceSubtype: "number"},
+				{Name: "Priority", ResourceSubtype: "enum", EnumOptions: []*client.EnumOption{{Name: "Low"}, {Name: "High"}}},
+				{Name: "Labels", ResourceSubtype: "multi_enum", EnumOptions: []*client.EnumOption{{Name: "Red"}, {Name: "Blue"}}},
+				{Name: "Owner", ResourceSubtype: "people"},
+			}
+			for _, cf := range fields {
+				s.AddCustomField(wrk, cf)
+			}
+
+			values := map[string]map[string]interface{}{
+				"A": {"Notes": "urgent", "Points": 1, "Priority": "Low"},
+				"B": {"Points": 5, "Priority": "High", "Labels": []string{"Blue"}},
+				"C": {"Labels": []string{"Red", "Blue"}, "Owner": []*client.User{me}},
+			}
+
+			c := s.Client()
+			// Setup alone would exhaust the default burst
+			c.SetRateLimit(client.NewRateLimit(1000, 1000))
+
+			ctx := context.Background()
+
+			wc, err := c.InWorkspace(ctx, "Work")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gids := map[string]string{}
+			for _, name := range []string{"A", "B", "C"} {
+				gids[name] = s.AddTask(wrk, &asanatest.Task{Name: name})
+
+				for field, value := range values[name] {
+					setCustomField(t, wc, gids[name], field, value)
+				}
+			}
+
+			p := test.rule(InWorkspace("Work"), me).AddTag("Hit")
+			defer func() { periodics = nil }()
+
+			_, err = p.run(ctx, c)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %t", err, test.wantErr)
+			}
+
+			got := []string{}
+			for _, name := range []string{"A", "B", "C"} {
+				if len(s.GetTask(gids[name]).Tags) > 0 {
+					got = append(got, name)
+				}
+			}
+
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("matched %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetCustomField(t *testing.T) {
+	options := []*client.EnumOption{{Name: "Low"}, {Name: "High"}}
+
+	tests := []struct {
+		subtype string
+		value   interface{}
+		want    string
+	}{
+		{"text", "hello", "hello"},
+		{"number", 2.5, "2.5"},
+		{"enum", "High", "High"},
+		{"multi_enum", []string{"Low", "High"}, "Low,High"},
+		{"date", civil.Date{Year: 2024, Month: 3, Day: 1}, "2024-03-01"},
+		{"people", []*client.User{{GID: "me"}}, "Me"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.subtype, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			me := s.AddUser("Me", "me@example.com")
+			s.SetMe(me)
+			gid := s.AddTask(wrk, &asanatest.Task{Name: "Task"})
+
+			cf := s.AddCustomField(wrk, &client.CustomField{
+				Name:            "Field",
+				ResourceSubtype: test.subtype,
+				EnumOptions:     options,
+			})
+
+			c := s.Client()
+			ctx := context.Background()
+
+			defer func() { periodics = nil }()
+
+			for _, step := range []struct {
+				value interface{}
+				want  string
+			}{
+				{test.value, test.want},
+				{nil, ""},
+			} {
+				p := InWorkspace("Work").SetCustomField("Field", step.value)
+
+				_, err := p.run(ctx, c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := ""
+				for _, val := range s.GetTask(gid).CustomFields {
+					if val.GID != cf.GID {
+						continue
+					}
+
+					if val.DisplayValue != nil {
+						got = *val.DisplayValue
+					}
+
+					names := []string{}
+					for _, opt := range val.MultiEnumValues {
+						names = append(names, opt.Name)
+					}
+					if len(names) > 0 {
+						got = strings.Join(names, ",")
+					}
+				}
+
+				if got != step.want {
+					t.Errorf("set to %v: got %q, want %q", step.value, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func setCustomField(t *testing.T, wc *client.WorkspaceClient, gid, field string, value interface{}) {
+	ctx := context.Background()
+
+	cf, err := wc.GetCustomFieldByName(ctx, field)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := cf.EncodeValue(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = wc.UpdateTask(ctx, &client.Task{GID: gid}, client.NewTaskPatch().SetCustomField(cf.GID, encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMembershipActors(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   func(*periodic) *periodic
+		member bool
+		want   func(*asanatest.Task) bool
+	}{
+		{"add tag", func(p *periodic) *periodic { return p.AddTag("Tag") }, false, hasTestTag},
+		{"add tag again", func(p *periodic) *periodic { return p.AddTag("Tag") }, true, hasTestTag},
+		{"remove tag", func(p *periodic) *periodic { return p.RemoveTag("Tag") }, true, not(hasTestTag)},
+		{"remove absent tag", func(p *periodic) *periodic { return p.RemoveTag("Tag") }, false, not(hasTestTag)},
+		{"add to project", func(p *periodic) *periodic { return p.AddToProject("Project") }, false, inTestProject},
+		{"add to project again", func(p *periodic) *periodic { return p.AddToProject("Project") }, true, inTestProject},
+		{"remove from project", func(p *periodic) *periodic { return p.RemoveFromProject("Project") }, true, not(inTestProject)},
+		{"remove from absent project", func(p *periodic) *periodic { return p.RemoveFromProject("Project") }, false, not(inTestProject)},
+		{"add followers", func(p *periodic) *periodic { return p.AddFollowers("me", "other@example.com") }, false, hasTestFollowers},
+		{"add followers again", func(p *periodic) *periodic { return p.AddFollowers("me", "other@example.com") }, true, hasTestFollowers},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+			me := s.AddUser("Me", "me@example.com")
+			s.SetMe(me)
+			other := s.AddUser("Other", "other@example.com")
+			tag := s.AddTag(wrk, "Tag")
+			proj := s.AddProject(wrk, "Project")
+			sec := s.AddSection(proj, "Section")
+
+			task := &asanatest.Task{Name: "Task"}
+			if test.member {
+				task.Tags = []*client.Tag{tag}
+				task.Sections = []*client.Section{sec}
+				task.Followers = []*client.User{me, other}
+			}
+			gid := s.AddTask(wrk, task)
+
+			p := test.rule(InWorkspace("Work"))
+			defer func() { periodics = nil }()
+
+			_, err := p.run(context.Background(), s.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.GetTask(gid)
+			if !test.want(got) {
+				t.Errorf("tags %v, sections %v, followers %v", got.Tags, got.Sections, got.Followers)
+			}
+
+			if len(got.Tags) > 1 || len(got.Sections) > 1 || len(got.Followers) > 2 {
+				t.Errorf("duplicated: tags %v, sections %v, followers %v", got.Tags, got.Sections, got.Followers)
+			}
+		})
+	}
+}
+
+func hasTestTag(t *asanatest.Task) bool {
+	return len(t.Tags) == 1 && t.Tags[0].Name == "Tag"
+}
+
+func inTestProject(t *asanatest.Task) bool {
+	return len(t.Sections) == 1 && t.Sections[0].Name == "Section"
+}
+
+func hasTestFollowers(t *asanatest.Task) bool {
+	names := []string{}
+	for _, u := range t.Followers {
+		names = append(names, u.Name)
+	}
+
+	return strings.Join(names, ",") == "Me,Other"
+}
+
+func not(pred func(*asanatest.Task) bool) func(*asanatest.Task) bool {
+	return func(t *asanatest.Task) bool {
+		return !pred(t)
+	}
+}
+
+func TestComment(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks int
+	}{
+		{"no tasks", 0},
+		{"one task", 1},
+		{"more than a batch", 12},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := asanatest.NewServer()
+			defer s.Close()
+
+			wrk := s.AddWorkspace("Work")
+
+			gids := []string{}
+			for i := 0; i < test.tasks; i++ {
+				gids = append(gids, s.AddTask(wrk, &asanatest.Task{Name: "Task"}))
+			}
+
+			c := s.Client()
+			c.SetRateLimit(client.NewRateLimit(1000, 1000))
+
+			p := InWorkspace("Work").Comment("<body>Done by rule</body>")
+			defer func() { periodics = nil }()
+
+			_, err := p.run(context.Background(), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, gid := range gids {
+				stories := s.GetStories(gid)
+				if len(stories) != 1 {
+					t.Fatalf("%d stories on %s, want 1", len(stories), gid)
+				}
+
+				if stories[0].Type != "comment" || stories[0].HTMLText != "<body>Done by rule</body>" {
+					t.Errorf("story %s %q", stories[0], stories[0].HTMLText)
+				}
+			}
+		})
+	}
+}
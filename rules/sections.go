@@ -0,0 +1,205 @@
+package rules
+
+import "context"
+import "fmt"
+
+import "github.com/firestuff/automana/client"
+
+type projectGetter func(context.Context, *client.WorkspaceClient) (*client.Project, error)
+
+type sectionLayout struct {
+	workspaceClientGetter workspaceClientGetter
+	projectGetter         projectGetter
+	names                 []string
+	deleteUnlisted        bool
+}
+
+var sectionLayouts = []*sectionLayout{}
+
+// EnsureMyTasksSections makes My Tasks in the named workspace start with
+// the given sections in this order, before any periodic runs. Missing
+// sections are created. Unlisted sections are kept, after the listed ones,
+// unless DeleteEmptyUnlisted is set. Asana pins "Recently Assigned" to the
+// top of My Tasks, so list it first.
+func EnsureMyTasksSections(workspace string, names ...string) *sectionLayout {
+	return addSectionLayout(workspace, names, func(ctx context.Context, wc *client.WorkspaceClient) (*client.Project, error) {
+		return wc.GetMyUserTaskList(ctx)
+	})
+}
+
+// EnsureProjectSections is EnsureMyTasksSections for a named project
+func EnsureProjectSections(workspace, project string, names ...string) *sectionLayout {
+	return addSectionLayout(workspace, names, func(ctx context.Context, wc *client.WorkspaceClient) (*client.Project, error) {
+		projects, err := projectsByNames(ctx, wc, []string{project})
+		if err != nil {
+			return nil, err
+		}
+
+		return projects[0], nil
+	})
+}
+
+func addSectionLayout(workspace string, names []string, getter projectGetter) *sectionLayout {
+	l := &sectionLayout{
+		workspaceClientGetter: func(ctx context.Context, c *client.Client) (*client.WorkspaceClient, error) {
+			return c.InWorkspace(ctx, workspace)
+		},
+		projectGetter: getter,
+		names:         names,
+	}
+
+	sectionLayouts = append(sectionLayouts, l)
+
+	return l
+}
+
+// DeleteEmptyUnlisted also deletes unlisted sections that hold no tasks,
+// so the layout contains exactly the listed sections where possible
+func (l *sectionLayout) DeleteEmptyUnlisted() *sectionLayout {
+	l.deleteUnlisted = true
+	return l
+}
+
+func ensureSections(ctx context.Context, c *client.Client) error {
+	for _, layout := range sectionLayouts {
+		err := layout.ensure(ctx, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *sectionLayout) ensure(ctx context.Context, c *client.Client) error {
+	wc, err := l.workspaceClientGetter(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	project, err := l.projectGetter(ctx, wc)
+	if err != nil {
+		return err
+	}
+
+	// Start from the current state, not whatever we cached
+	wc.InvalidateSections(project)
+
+	cached, err := wc.GetSections(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	// Our own copy, reordered as we move things
+	secs := append([]*client.Section{}, cached...)
+
+	for _, name := range l.names {
+		if indexOfSection(secs, name) != -1 {
+			continue
+		}
+
+		sec, err := wc.CreateSection(ctx, project, name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created section '%s' in %s\n", name, project)
+		secs = append(secs, sec)
+	}
+
+	if l.deleteUnlisted {
+		secs, err = l.removeUnlisted(ctx, wc, project, secs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(l.names) == 0 {
+		return nil
+	}
+
+	// Listed sections go to the top, each moved only if it isn't already
+	// in place
+	first := indexOfSection(secs, l.names[0])
+	if first != 0 {
+		sec := secs[first]
+
+		err = wc.MoveSectionBefore(ctx, project, sec, secs[0])
+		if err != nil {
+			return err
+		}
+
+		secs = append(secs[:first], secs[first+1:]...)
+		secs = append([]*client.Section{sec}, secs...)
+	}
+
+	for i := 1; i < len(l.names); i++ {
+		prev := indexOfSection(secs, l.names[i-1])
+		cur := indexOfSection(secs, l.names[i])
+
+		if cur == prev+1 {
+			continue
+		}
+
+		sec := secs[cur]
+
+		err = wc.MoveSectionAfter(ctx, project, sec, secs[prev])
+		if err != nil {
+			return err
+		}
+
+		secs = append(secs[:cur], secs[cur+1:]...)
+		prev = indexOfSection(secs, l.names[i-1])
+		secs = append(secs[:prev+1], append([]*client.Section{sec}, secs[prev+1:]...)...)
+	}
+
+	return nil
+}
+
+// removeUnlisted deletes unlisted sections that are empty and returns the
+// sections that remain
+func (l *sectionLayout) removeUnlisted(ctx context.Context, wc *client.WorkspaceClient, project *client.Project, secs []*client.Section) ([]*client.Section, error) {
+	listed := map[string]bool{}
+	for _, name := range l.names {
+		listed[name] = true
+	}
+
+	ret := []*client.Section{}
+
+	for _, sec := range secs {
+		if listed[sec.Name] {
+			ret = append(ret, sec)
+			continue
+		}
+
+		empty, err := wc.SectionIsEmpty(ctx, sec)
+		if err != nil {
+			return nil, err
+		}
+
+		if !empty {
+			fmt.Printf("Keeping unlisted section '%s' in %s: it isn't empty\n", sec.Name, project)
+			ret = append(ret, sec)
+			continue
+		}
+
+		err = wc.DeleteSection(ctx, sec)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Deleted unlisted section '%s' in %s\n", sec.Name, project)
+	}
+
+	return ret, nil
+}
+
+func indexOfSection(secs []*client.Section, name string) int {
+	for i, sec := range secs {
+		if sec.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
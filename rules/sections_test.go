@@ -0,0 +1,146 @@
+package rules
+
+import "context"
+import "strings"
+import "testing"
+
+import "github.com/firestuff/automana/asanatest"
+import "github.com/firestuff/automana/client"
+
+func TestEnsureSections(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		nonEmpty []string
+		listed   []string
+		delete   bool
+		want     []string
+	}{
+		{
+			name:     "already in order",
+			existing: []string{"A", "B", "C"},
+			listed:   []string{"A", "B", "C"},
+			want:     []string{"A", "B", "C"},
+		},
+		{
+			name:     "reversed",
+			existing: []string{"C", "B", "A"},
+			listed:   []string{"A", "B", "C"},
+			want:     []string{"A", "B", "C"},
+		},
+		{
+			name:     "missing",
+			existing: []string{"B"},
+			listed:   []string{"A", "B", "C"},
+			want:     []string{"A", "B", "C"},
+		},
+		{
+			name:     "unlisted above listed",
+			existing: []string{"Extra", "Empty", "B", "A"},
+			nonEmpty: []string{"Extra"},
+			listed:   []string{"A", "B"},
+			want:     []string{"A", "B", "Extra", "Empty"},
+		},
+		{
+			name:     "unlisted between listed",
+			existing: []string{"A", "Extra", "Empty", "B"},
+			nonEmpty: []string{"Extra"},
+			listed:   []string{"A", "B"},
+			want:     []string{"A", "B", "Extra", "Empty"},
+		},
+		{
+			name:     "delete unlisted above listed",
+			existing: []string{"Extra", "Empty", "B", "A"},
+			nonEmpty: []string{"Extra"},
+			listed:   []string{"A", "B"},
+			delete:   true,
+			want:     []string{"A", "B", "Extra"},
+		},
+		{
+			name:     "delete unlisted between listed",
+			existing: []string{"A", "Extra", "Empty", "B"},
+			nonEmpty: []string{"Extra"},
+			listed:   []string{"A", "B"},
+			delete:   true,
+			want:     []string{"A", "B", "Extra"},
+		},
+	}
+
+	for _, test := range tests {
+		s := asanatest.NewServer()
+
+		wrk := s.AddWorkspace("Work")
+		proj := s.AddProject(wrk, "Project")
+
+		for _, name := range test.existing {
+			sec := s.AddSection(proj, name)
+
+			for _, nonEmpty := range test.nonEmpty {
+				if name == nonEmpty {
+					s.AddTask(wrk, &asanatest.Task{
+						Name:     "Task",
+						Sections: []*client.Section{sec},
+					})
+				}
+			}
+		}
+
+		sectionLayouts = nil
+		l := EnsureProjectSections("Work", "Project", test.listed...)
+		if test.delete {
+			l.DeleteEmptyUnlisted()
+		}
+
+		c := s.Client()
+		ctx := context.Background()
+
+		for run := 0; run < 2; run++ {
+			before := len(s.Requests())
+
+			err := ensureSections(ctx, c)
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+
+			got := sectionNames(t, c, proj)
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("%s: run %d: got %v, want %v", test.name, run, got, test.want)
+			}
+
+			if run == 1 {
+				for _, req := range s.Requests()[before:] {
+					if !strings.HasPrefix(req, "GET ") {
+						t.Errorf("%s: second run made changes: %s", test.name, req)
+					}
+				}
+			}
+		}
+
+		s.Close()
+	}
+
+	sectionLayouts = nil
+}
+
+func sectionNames(t *testing.T, c *client.Client, proj *client.Project) []string {
+	ctx := context.Background()
+
+	wc, err := c.InWorkspace(ctx, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wc.InvalidateSections(proj)
+
+	secs, err := wc.GetSections(ctx, proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret := []string{}
+	for _, sec := range secs {
+		ret = append(ret, sec.Name)
+	}
+
+	return ret
+}
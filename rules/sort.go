@@ -0,0 +1,322 @@
+package rules
+
+import "context"
+import "fmt"
+import "sort"
+import "strings"
+
+import "github.com/firestuff/automana/client"
+
+type sectionActor func(context.Context, *client.WorkspaceClient) error
+
+// SortKey orders tasks for SortSectionBy. Keys are resolved once per run,
+// so they can look up things like custom field definitions.
+type SortKey func(context.Context, *client.WorkspaceClient) (taskCompare, error)
+
+// Negative if a sorts before b
+type taskCompare func(a, b *client.Task) int
+
+// ByDueDate sorts earliest first, with undated tasks last. Tasks due on a
+// day sort before tasks due at a time that day.
+func ByDueDate() SortKey {
+	return func(ctx context.Context, wc *client.WorkspaceClient) (taskCompare, error) {
+		return func(a, b *client.Task) int {
+			return strings.Compare(dueKey(a), dueKey(b))
+		}, nil
+	}
+}
+
+func ByCreatedAt() SortKey {
+	return func(ctx context.Context, wc *client.WorkspaceClient) (taskCompare, error) {
+		return func(a, b *client.Task) int {
+			switch {
+			case a.ParsedCreatedAt == nil || b.ParsedCreatedAt == nil:
+				return 0
+			case a.ParsedCreatedAt.Before(*b.ParsedCreatedAt):
+				return -1
+			case b.ParsedCreatedAt.Before(*a.ParsedCreatedAt):
+				return 1
+			default:
+				return 0
+			}
+		}, nil
+	}
+}
+
+// ByName sorts case-insensitively
+func ByName() SortKey {
+	return func(ctx context.Context, wc *client.WorkspaceClient) (taskCompare, error) {
+		return func(a, b *client.Task) int {
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}, nil
+	}
+}
+
+// ByCustomField sorts enum fields in the order their options are defined
+// (so "High, Medium, Low" works as a priority) and number fields in
+// ascending order. Tasks without a value sort last.
+func ByCustomField(name string) SortKey {
+	return func(ctx context.Context, wc *client.WorkspaceClient) (taskCompare, error) {
+		cf, err := wc.GetCustomFieldByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		rank := map[string]float64{}
+		for i, opt := range cf.EnumOptions {
+			rank[opt.GID] = float64(i)
+		}
+
+		value := func(t *client.Task) *float64 {
+			for _, val := range t.CustomFields {
+				if val.GID != cf.GID {
+					continue
+				}
+
+				if val.NumberValue != nil {
+					return val.NumberValue
+				}
+
+				if val.EnumValue != nil {
+					r, found := rank[val.EnumValue.GID]
+					if found {
+						return &r
+					}
+				}
+			}
+
+			return nil
+		}
+
+		return func(a, b *client.Task) int {
+			va := value(a)
+			vb := value(b)
+
+			switch {
+			case va == nil && vb == nil:
+				return 0
+			case va == nil:
+				return 1
+			case vb == nil:
+				return -1
+			case *va < *vb:
+				return -1
+			case *va > *vb:
+				return 1
+			default:
+				return 0
+			}
+		}, nil
+	}
+}
+
+// Descending reverses key, including where it puts missing values
+func Descending(key SortKey) SortKey {
+	return func(ctx context.Context, wc *client.WorkspaceClient) (taskCompare, error) {
+		cmp, err := key(ctx, wc)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(a, b *client.Task) int {
+			return -cmp(a, b)
+		}, nil
+	}
+}
+
+// SortSectionBy keeps the named My Tasks section ordered by keys, with later
+// keys breaking ties. Tasks that tie on every key keep their current order.
+func (p *periodic) SortSectionBy(section string, keys ...SortKey) *periodic {
+	return p.sortSectionBy(func(ctx context.Context, wc *client.WorkspaceClient) (*client.Project, error) {
+		return wc.GetMyUserTaskList(ctx)
+	}, section, keys)
+}
+
+// SortProjectSectionBy is SortSectionBy for a section of a named project
+func (p *periodic) SortProjectSectionBy(project, section string, keys ...SortKey) *periodic {
+	return p.sortSectionBy(func(ctx context.Context, wc *client.WorkspaceClient) (*client.Project, error) {
+		projects, err := projectsByNames(ctx, wc, []string{project})
+		if err != nil {
+			return nil, err
+		}
+
+		return projects[0], nil
+	}, section, keys)
+}
+
+func (p *periodic) sortSectionBy(getter projectGetter, name string, keys []SortKey) *periodic {
+	p.sectionActors = append(p.sectionActors, func(ctx context.Context, wc *client.WorkspaceClient) error {
+		project, err := getter(ctx, wc)
+		if err != nil {
+			return err
+		}
+
+		sec, err := wc.GetSectionByName(ctx, project, name)
+		if err != nil {
+			return err
+		}
+
+		cmps := []taskCompare{}
+		for _, key := range keys {
+			cmp, err := key(ctx, wc)
+			if err != nil {
+				return err
+			}
+			cmps = append(cmps, cmp)
+		}
+
+		tasks, err := wc.GetTasksFromSection(ctx, sec)
+		if err != nil {
+			return err
+		}
+
+		target := append([]*client.Task{}, tasks...)
+		sort.SliceStable(target, func(i, j int) bool {
+			for _, cmp := range cmps {
+				c := cmp(target[i], target[j])
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+
+		for _, move := range planMoves(tasks, target) {
+			if move.after == nil {
+				err = wc.AddTaskToSectionBefore(ctx, move.task, sec, move.before)
+			} else {
+				err = wc.AddTaskToSectionAfter(ctx, move.task, sec, move.after)
+			}
+			if err != nil {
+				return err
+			}
+
+			periodicActions.Inc(p.name)
+		}
+
+		return nil
+	})
+
+	p.resourceGetters = append(p.resourceGetters, func(ctx context.Context, wc *client.WorkspaceClient) (string, error) {
+		project, err := getter(ctx, wc)
+		if err != nil {
+			return "", err
+		}
+
+		return project.GID, nil
+	})
+
+	return p
+}
+
+type taskMove struct {
+	task   *client.Task
+	before *client.Task
+	after  *client.Task
+}
+
+func (m *taskMove) String() string {
+	if m.after == nil {
+		return fmt.Sprintf("move %s before %s", m.task, m.before)
+	}
+
+	return fmt.Sprintf("move %s after %s", m.task, m.after)
+}
+
+// planMoves returns the fewest single-task moves that turn current into
+// target: everything outside a longest run of tasks already in target order
+// is moved next to its target predecessor. Moves must be applied in order.
+func planMoves(current, target []*client.Task) []*taskMove {
+	if len(current) < 2 {
+		return nil
+	}
+
+	rank := map[string]int{}
+	for i, t := range target {
+		rank[t.GID] = i
+	}
+
+	ranks := []int{}
+	for _, t := range current {
+		ranks = append(ranks, rank[t.GID])
+	}
+
+	keep := map[int]bool{}
+	for _, r := range longestIncreasing(ranks) {
+		keep[r] = true
+	}
+
+	moves := []*taskMove{}
+
+	for i, t := range target {
+		if keep[i] {
+			continue
+		}
+
+		if i == 0 {
+			// Nothing to go after; go before the first task we're keeping,
+			// which everything else will end up after
+			for j := 1; j < len(target); j++ {
+				if keep[j] {
+					moves = append(moves, &taskMove{task: t, before: target[j]})
+					break
+				}
+			}
+			continue
+		}
+
+		moves = append(moves, &taskMove{task: t, after: target[i-1]})
+	}
+
+	return moves
+}
+
+// longestIncreasing returns the values of a longest strictly increasing
+// subsequence of vals
+func longestIncreasing(vals []int) []int {
+	// tails[k] is the index in vals of the smallest tail of an increasing
+	// subsequence of length k+1
+	tails := []int{}
+	prev := make([]int, len(vals))
+
+	for i, v := range vals {
+		k := sort.Search(len(tails), func(k int) bool {
+			return vals[tails[k]] >= v
+		})
+
+		if k > 0 {
+			prev[i] = tails[k-1]
+		} else {
+			prev[i] = -1
+		}
+
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	ret := make([]int, len(tails))
+	if len(tails) == 0 {
+		return ret
+	}
+
+	for i, k := len(tails)-1, tails[len(tails)-1]; i >= 0; i, k = i-1, prev[k] {
+		ret[i] = vals[k]
+	}
+
+	return ret
+}
+
+// dueKey sorts lexically: a date before times on that date, undated last
+func dueKey(t *client.Task) string {
+	switch {
+	case t.ParsedDueAt != nil:
+		return t.ParsedDueAt.Local().Format("2006-01-02T15:04:05")
+	case t.DueOn != "":
+		return t.DueOn
+	default:
+		return "~"
+	}
+}
@@ -0,0 +1,138 @@
+package rules
+
+import "fmt"
+import "math/rand"
+import "testing"
+
+import "github.com/firestuff/automana/client"
+
+func tasksFromOrder(order []int) []*client.Task {
+	ret := []*client.Task{}
+	for _, i := range order {
+		ret = append(ret, &client.Task{GID: fmt.Sprintf("%d", i)})
+	}
+	return ret
+}
+
+// applyMoves simulates Asana's insert before/after on a task list
+func applyMoves(t *testing.T, tasks []*client.Task, moves []*taskMove) []*client.Task {
+	list := append([]*client.Task{}, tasks...)
+
+	indexOf := func(gid string) int {
+		for i, task := range list {
+			if task.GID == gid {
+				return i
+			}
+		}
+		t.Fatalf("task %s not in list", gid)
+		return -1
+	}
+
+	for _, m := range moves {
+		i := indexOf(m.task.GID)
+		list = append(list[:i], list[i+1:]...)
+
+		var j int
+		if m.after != nil {
+			j = indexOf(m.after.GID) + 1
+		} else {
+			j = indexOf(m.before.GID)
+		}
+
+		list = append(list[:j], append([]*client.Task{m.task}, list[j:]...)...)
+	}
+
+	return list
+}
+
+// lisLength is a simple O(n^2) longest increasing subsequence, to check
+// longestIncreasing against
+func lisLength(vals []int) int {
+	best := 0
+	lengths := make([]int, len(vals))
+
+	for i := range vals {
+		lengths[i] = 1
+		for j := 0; j < i; j++ {
+			if vals[j] < vals[i] && lengths[j]+1 > lengths[i] {
+				lengths[i] = lengths[j] + 1
+			}
+		}
+
+		if lengths[i] > best {
+			best = lengths[i]
+		}
+	}
+
+	return best
+}
+
+func TestPlanMoves(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []int
+		moves   int
+	}{
+		{"empty", []int{}, 0},
+		{"single", []int{0}, 0},
+		{"sorted", []int{0, 1, 2, 3, 4}, 0},
+		{"reversed", []int{4, 3, 2, 1, 0}, 4},
+		{"first moved to end", []int{1, 2, 3, 4, 0}, 1},
+		{"last moved to front", []int{4, 0, 1, 2, 3}, 1},
+		{"swap", []int{0, 2, 1, 3}, 1},
+		{"interleaved", []int{3, 0, 4, 1, 5, 2}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := tasksFromOrder(test.current)
+			target := tasksFromOrder(sortedOrder(len(test.current)))
+
+			moves := planMoves(current, target)
+			if len(moves) != test.moves {
+				t.Errorf("%d moves, want %d: %v", len(moves), test.moves, moves)
+			}
+
+			checkOrder(t, applyMoves(t, current, moves), target)
+		})
+	}
+}
+
+func TestPlanMovesRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for n := 2; n < 40; n++ {
+		order := rng.Perm(n)
+
+		current := tasksFromOrder(order)
+		target := tasksFromOrder(sortedOrder(n))
+
+		moves := planMoves(current, target)
+
+		// Everything outside a longest increasing run moves, once
+		want := n - lisLength(order)
+		if len(moves) != want {
+			t.Errorf("%v: %d moves, want %d", order, len(moves), want)
+		}
+
+		checkOrder(t, applyMoves(t, current, moves), target)
+	}
+}
+
+func sortedOrder(n int) []int {
+	ret := []int{}
+	for i := 0; i < n; i++ {
+		ret = append(ret, i)
+	}
+	return ret
+}
+
+func checkOrder(t *testing.T, got, want []*client.Task) {
+	t.Helper()
+
+	for i := range want {
+		if got[i].GID != want[i].GID {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package rules
+
+import "context"
+import "fmt"
+import "net"
+import "net/http"
+import "time"
+
+import "github.com/firestuff/automana/client"
+import "github.com/firestuff/automana/metrics"
+import "github.com/firestuff/automana/webhook"
+
+// Run every periodic at least this often even without events, to catch
+// time-based gates and lost deliveries
+const webhookFallbackInterval = 15 * time.Minute
+
+// ServeWebhooks is an alternative to Loop for when Asana can reach us.
+// It listens on listenAddr, registers webhooks pointing at publicURL for
+// every resource the periodics watch, and runs each periodic only when
+// an event arrives for a resource it watches (periodics that watch nothing
+// run on every event). Webhooks are deleted when ctx is cancelled.
+func ServeWebhooks(ctx context.Context, listenAddr, publicURL string) error {
+	c := client.NewClientFromEnv()
+	c.SetMetrics(metrics.Default, "webhook")
+
+	return serveWebhooks(ctx, c, listenAddr, publicURL)
+}
+
+func serveWebhooks(ctx context.Context, c *client.Client, listenAddr, publicURL string) error {
+	for _, p := range periodics {
+		err := p.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := ensureSections(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	handler := webhook.NewHandler(func(resource string, events []*client.Event) {
+		for _, p := range periodics {
+			if len(p.watched) == 0 || p.watched[resource] {
+				p.poke()
+			}
+		}
+	})
+
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler: handler,
+	}
+
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	wcsByResource := map[string]*client.WorkspaceClient{}
+
+	for _, p := range periodics {
+		wc, err := p.workspaceClientGetter(ctx, c)
+		if err != nil {
+			return err
+		}
+
+		p.watched = map[string]bool{}
+
+		for _, getter := range p.resourceGetters {
+			resource, err := getter(ctx, wc)
+			if err != nil {
+				return err
+			}
+
+			p.watched[resource] = true
+			wcsByResource[resource] = wc
+		}
+	}
+
+	for resource, wc := range wcsByResource {
+		target := webhook.TargetURL(publicURL, resource)
+
+		err = deleteWebhooks(ctx, wc, target)
+		if err != nil {
+			return err
+		}
+
+		handler.ExpectHandshake(resource)
+		_, err = wc.CreateWebhook(ctx, resource, target)
+		handler.EndHandshake(resource)
+		if err != nil {
+			return err
+		}
+
+		// Clean up after ourselves, even though ctx is cancelled by then
+		defer deleteWebhooks(context.Background(), wc, target)
+	}
+
+	for _, p := range periodics {
+		// Catch up on anything that changed while we weren't listening
+		p.poke()
+
+		go p.triggeredLoop(ctx, c)
+	}
+
+	for _, p := range periodics {
+		p.wait()
+	}
+
+	return nil
+}
+
+func deleteWebhooks(ctx context.Context, wc *client.WorkspaceClient, target string) error {
+	hooks, err := wc.GetWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		if hook.Target != target {
+			continue
+		}
+
+		err = wc.DeleteWebhook(ctx, hook)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// poke schedules a run, coalescing with any that is already pending
+func (p *periodic) poke() {
+	select {
+	case p.trigger <- true:
+	default:
+	}
+}
+
+func (p *periodic) triggeredLoop(ctx context.Context, c *client.Client) {
+	defer close(p.done)
+
+	timer := time.NewTimer(webhookFallbackInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-p.trigger:
+
+		case <-timer.C:
+		}
+
+		err := p.exec(ctx, c)
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("ERROR: %s\n", err)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(webhookFallbackInterval)
+	}
+}
@@ -0,0 +1,193 @@
+package webhook
+
+import "crypto/hmac"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/json"
+import "fmt"
+import "io/ioutil"
+import "net/http"
+import "path"
+import "strings"
+import "sync"
+import "time"
+
+import "github.com/firestuff/automana/client"
+
+// How long to remember deliveries for deduplication
+const dedupWindow = 10 * time.Minute
+
+// Callback receives the events from one delivery for resource. Heartbeats
+// with no events are not passed on.
+type Callback func(resource string, events []*client.Event)
+
+// Handler receives Asana webhook deliveries at TargetURL(base, resource).
+type Handler struct {
+	callback Callback
+
+	mu      sync.Mutex
+	secrets map[string][]byte
+	pending map[string]bool
+	seen    map[string]time.Time
+}
+
+type delivery struct {
+	Events []json.RawMessage `json:"events"`
+}
+
+func NewHandler(callback Callback) *Handler {
+	return &Handler{
+		callback: callback,
+		secrets:  map[string][]byte{},
+		pending:  map[string]bool{},
+		seen:     map[string]time.Time{},
+	}
+}
+
+// ExpectHandshake allows one X-Hook-Secret handshake for resource, replacing
+// any secret from an earlier webhook. Call it before CreateWebhook and
+// EndHandshake after it returns; handshakes at any other time are rejected,
+// so nobody else can choose the secret.
+func (h *Handler) ExpectHandshake(resource string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.secrets, resource)
+	h.pending[resource] = true
+}
+
+func (h *Handler) EndHandshake(resource string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.pending, resource)
+}
+
+// TargetURL is where to point the webhook for resource, given the URL that
+// Handler is reachable at
+func TargetURL(baseURL, resource string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(baseURL, "/"), resource)
+}
+
+// Sign returns the X-Hook-Signature value for body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resource := path.Base(r.URL.Path)
+
+	secret := r.Header.Get("X-Hook-Secret")
+	if secret != "" {
+		h.handshake(w, resource, secret)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.verify(resource, body, r.Header.Get("X-Hook-Signature")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	d := &delivery{}
+	err = json.Unmarshal(body, d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parsed := []*client.Event{}
+	for _, raw := range d.Events {
+		ev := &client.Event{}
+		err = json.Unmarshal(raw, ev)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		parsed = append(parsed, ev)
+	}
+
+	// Only once the whole delivery is accepted, so a rejected one isn't
+	// mistaken for a duplicate when Asana retries it
+	events := []*client.Event{}
+	for i, raw := range d.Events {
+		if h.firstSeen(resource, raw) {
+			events = append(events, parsed[i])
+		}
+	}
+
+	// Acknowledge before running rules, so Asana doesn't time out and redeliver
+	w.WriteHeader(http.StatusOK)
+
+	if len(events) > 0 {
+		go h.callback(resource, events)
+	}
+}
+
+func (h *Handler) handshake(w http.ResponseWriter, resource, secret string) {
+	h.mu.Lock()
+
+	_, hasSecret := h.secrets[resource]
+	if !h.pending[resource] || hasSecret {
+		h.mu.Unlock()
+		http.Error(w, "unexpected handshake", http.StatusForbidden)
+		return
+	}
+
+	h.secrets[resource] = []byte(secret)
+	delete(h.pending, resource)
+	h.mu.Unlock()
+
+	w.Header().Set("X-Hook-Secret", secret)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) verify(resource string, body []byte, signature string) bool {
+	h.mu.Lock()
+	secret, found := h.secrets[resource]
+	h.mu.Unlock()
+
+	if !found || signature == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// firstSeen records raw and returns whether it wasn't delivered recently
+func (h *Handler) firstSeen(resource string, raw json.RawMessage) bool {
+	sum := sha256.Sum256(raw)
+	key := fmt.Sprintf("%s/%s", resource, hex.EncodeToString(sum[:]))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+
+	for k, t := range h.seen {
+		if now.Sub(t) > dedupWindow {
+			delete(h.seen, k)
+		}
+	}
+
+	_, found := h.seen[key]
+	if found {
+		return false
+	}
+
+	h.seen[key] = now
+	return true
+}
@@ -0,0 +1,173 @@
+package webhook_test
+
+import "net/http"
+import "net/http/httptest"
+import "strings"
+import "sync"
+import "testing"
+import "time"
+
+import "github.com/firestuff/automana/client"
+import "github.com/firestuff/automana/webhook"
+
+type calls struct {
+	mu     sync.Mutex
+	events []*client.Event
+	done   chan bool
+}
+
+func newHandler() (*webhook.Handler, *calls) {
+	c := &calls{
+		done: make(chan bool, 10),
+	}
+
+	h := webhook.NewHandler(func(resource string, events []*client.Event) {
+		c.mu.Lock()
+		c.events = append(c.events, events...)
+		c.mu.Unlock()
+		c.done <- true
+	})
+
+	return h, c
+}
+
+func (c *calls) wait(t *testing.T) {
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not called")
+	}
+}
+
+func handshake(h http.Handler, resource, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/"+resource, nil)
+	req.Header.Set("X-Hook-Secret", secret)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func deliver(h http.Handler, resource, secret, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/"+resource, strings.NewReader(body))
+	req.Header.Set("X-Hook-Signature", webhook.Sign([]byte(secret), []byte(body)))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestHandshake(t *testing.T) {
+	h, _ := newHandler()
+
+	tests := []struct {
+		name   string
+		expect bool
+		secret string
+		status int
+	}{
+		{"unsolicited", false, "evil", http.StatusForbidden},
+		{"expected", true, "good", http.StatusOK},
+		{"replay after success", false, "evil", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		if test.expect {
+			h.ExpectHandshake("123")
+		}
+
+		w := handshake(h, "123", test.secret)
+		h.EndHandshake("123")
+
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, w.Code, test.status)
+		}
+
+		if w.Code == http.StatusOK && w.Header().Get("X-Hook-Secret") != test.secret {
+			t.Errorf("%s: secret not echoed", test.name)
+		}
+	}
+
+	// Only the expected secret may sign deliveries
+	body := `{"events":[]}`
+
+	w := deliver(h, "123", "evil", body)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("delivery signed with injected secret: status %d", w.Code)
+	}
+
+	w = deliver(h, "123", "good", body)
+	if w.Code != http.StatusOK {
+		t.Errorf("delivery signed with real secret: status %d", w.Code)
+	}
+}
+
+func TestHandshakeWindowCloses(t *testing.T) {
+	h, _ := newHandler()
+
+	h.ExpectHandshake("123")
+	h.EndHandshake("123")
+
+	w := handshake(h, "123", "late")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("handshake after EndHandshake: status %d", w.Code)
+	}
+}
+
+func TestDeliveryDedup(t *testing.T) {
+	h, c := newHandler()
+
+	h.ExpectHandshake("123")
+	handshake(h, "123", "s")
+	h.EndHandshake("123")
+
+	body := `{"events":[{"action":"changed","resource":{"gid":"456","resource_type":"task"}}]}`
+
+	for i := 0; i < 2; i++ {
+		w := deliver(h, "123", "s", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("delivery %d: status %d", i, w.Code)
+		}
+	}
+
+	c.wait(t)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.events) != 1 {
+		t.Errorf("got %d events, want 1 after redelivery", len(c.events))
+	}
+}
+
+func TestRejectedDeliveryNotSeen(t *testing.T) {
+	h, c := newHandler()
+
+	h.ExpectHandshake("123")
+	handshake(h, "123", "s")
+	h.EndHandshake("123")
+
+	good := `{"action":"changed","resource":{"gid":"456","resource_type":"task"}}`
+	bad := `{"action":17}`
+
+	w := deliver(h, "123", "s", `{"events":[`+good+`,`+bad+`]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed delivery: status %d", w.Code)
+	}
+
+	w = deliver(h, "123", "s", `{"events":[`+good+`]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("redelivery: status %d", w.Code)
+	}
+
+	c.wait(t)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.events) != 1 {
+		t.Errorf("got %d events, want 1 from redelivery", len(c.events))
+	}
+}